@@ -12,7 +12,6 @@ import (
 
 	"github.com/rs/zerolog/log"
 	"github.com/skvoch/reter/scheduler"
-	"golang.org/x/sync/errgroup"
 )
 
 var (
@@ -46,29 +45,34 @@ func main() {
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to connect to etcd")
 	}
-	g, ctx := errgroup.WithContext(context.Background())
 
-	g.Go(func() error {
-		return NotifySigterm(ctx)
-	})
-
-	g.Go(func() error {
-		return s.Every(10).Seconds().Do(ctx, "seconds", func() {
-			fmt.Println("print every 10 second")
-		})
-	})
+	// tasks are registered synchronously and run in the background
+	if _, err := s.Every(10).Seconds().Start(context.Background(), "seconds", func(ctx context.Context) error {
+		fmt.Println("print every 10 second")
+		return nil
+	}); err != nil {
+		log.Fatal().Err(err).Msg("failed to start task")
+	}
 
-	g.Go(func() error {
-		return s.Every().Interval(time.Second*3).Do(ctx, "interval", func() {
-			fmt.Println("print every 3 second")
-		})
-	})
+	if _, err := s.Every().Interval(time.Second*3).Start(context.Background(), "interval", func(ctx context.Context) error {
+		fmt.Println("print every 3 second")
+		return nil
+	}); err != nil {
+		log.Fatal().Err(err).Msg("failed to start task")
+	}
 
-	if err := g.Wait(); err != nil {
-		if errors.Is(err, ErrSigint) {
+	go func() {
+		if err := NotifySigterm(context.Background()); errors.Is(err, ErrSigint) {
 			log.Info().Msg("graceful shutdown")
-		} else {
-			log.Error().Err(err).Msg("err group waiting")
 		}
-	}
+
+		// running handlers are given 30 seconds to finish
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil {
+			log.Error().Err(err).Msg("scheduler shutdown")
+		}
+	}()
+
+	s.Wait()
 }
@@ -0,0 +1,107 @@
+// Package backend defines the storage the scheduler uses to coordinate task executions between nodes.
+package backend
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/skvoch/reter/scheduler/models"
+)
+
+var (
+	ErrAlreadyLocked = errors.New("already locked")
+)
+
+// Lock is an exclusive lock of a task held by a single node
+type Lock interface {
+	// Lost is closed when the lock can not be kept anymore, so it is not exclusive
+	Lost() <-chan struct{}
+	Release(ctx context.Context) error
+}
+
+// Backend stores task locks and execution state shared by all nodes
+type Backend interface {
+	// Acquire takes the task lock, ErrAlreadyLocked is returned if it is held by another node.
+	// The lock is kept until it is released or lost, ttl bounds how long it outlives a crashed node.
+	Acquire(ctx context.Context, taskName string, ttl time.Duration) (Lock, error)
+
+	// GetLastActionTime returns the time of the last successful execution, nil if there is none
+	GetLastActionTime(ctx context.Context, taskName string) (*time.Time, error)
+	SetLastActionTime(ctx context.Context, taskName string, t time.Time) error
+	SetLastFailure(ctx context.Context, taskName string, failure models.Failure) error
+}
+
+// Claimer is implemented by backends which can check that a task is due and claim its schedule slot atomically,
+// so a slot is run at most once even if two nodes have read the same last action time.
+// Without it the scheduler re-reads the last action time after the lock is acquired.
+type Claimer interface {
+	// Claim sets the last action time to t if isDue reports true for the stored one and it has not changed
+	// in between, false is returned if the task is not due or the slot has been claimed by another node.
+	// The replaced last action time is returned, so the claim can be reverted with Unclaim.
+	Claim(ctx context.Context, taskName string, t time.Time, isDue func(lastActionTime *time.Time) bool) (bool, *time.Time, error)
+	// Unclaim restores the previous last action time unless the claimed one has been changed since then
+	Unclaim(ctx context.Context, taskName string, claimed time.Time, previous *time.Time) error
+}
+
+// Clock is implemented by backends which can tell the current time of their server,
+// it is used instead of the local clock of the node when the scheduler runs in server time mode
+type Clock interface {
+	Now(ctx context.Context) (time.Time, error)
+}
+
+// ControlHandler receives commands sent to a task on all nodes
+type ControlHandler interface {
+	// SetPaused is called with the current paused state of the tasks and on every change of it
+	SetPaused(taskName string, paused bool)
+	// HasTask reports whether the task runs on this node, triggers are claimed only by such nodes
+	HasTask(taskName string) bool
+	// Trigger is called on the single node which has claimed the trigger of the task
+	Trigger(taskName string)
+}
+
+// Controller is implemented by backends which let operators pause, resume and trigger tasks cluster-wide
+type Controller interface {
+	// WatchControl passes the control commands to the handler until ctx is done or the watch fails
+	WatchControl(ctx context.Context, handler ControlHandler) error
+	// ClaimTrigger claims the trigger of the task made while no node was running it,
+	// true is returned if this node has claimed it and has to run the task
+	ClaimTrigger(ctx context.Context, taskName string) (bool, error)
+}
+
+// DefinitionHandler receives the task definitions stored in the backend
+type DefinitionHandler interface {
+	// PutDefinition is called with the stored definitions and on every change of them
+	PutDefinition(name string, spec []byte)
+	DeleteDefinition(name string)
+}
+
+// DefinitionSource is implemented by backends which keep task definitions, so tasks can be managed without a redeploy
+type DefinitionSource interface {
+	// WatchDefinitions passes the definitions to the handler until ctx is done or the watch fails
+	WatchDefinitions(ctx context.Context, handler DefinitionHandler) error
+}
+
+// LockInspector is implemented by backends which can tell who holds a task lock
+type LockInspector interface {
+	// LockHolder returns an opaque id of the current lock holder, e.g. the etcd lease ID, empty if the task is not locked
+	LockHolder(ctx context.Context, taskName string) (string, error)
+}
+
+// HistoryStore is implemented by backends which keep the execution history of tasks
+type HistoryStore interface {
+	// AddExecution records the execution and drops the records beyond the retention
+	AddExecution(ctx context.Context, taskName string, execution models.Execution, retention models.Retention) error
+	// History returns up to limit latest executions, the newest first, all of them if limit is not positive
+	History(ctx context.Context, taskName string, limit int) ([]models.Execution, error)
+}
+
+// StateStore is implemented by backends which keep the full execution state record of a task
+// instead of the bare last action time
+type StateStore interface {
+	// GetState returns the state record, nil if the task has never been run
+	GetState(ctx context.Context, taskName string) (*models.State, error)
+	// UpdateState applies the update to the stored record atomically, the update may be called more than once
+	// if the record is changed concurrently
+	UpdateState(ctx context.Context, taskName string, update func(state models.State) models.State) error
+}
@@ -0,0 +1,224 @@
+// Package etcdbackend provides a backend which keeps task locks and execution state in etcd.
+package etcdbackend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	etcd "go.etcd.io/etcd/client/v3"
+
+	"github.com/skvoch/reter/scheduler/backend"
+	"github.com/skvoch/reter/scheduler/models"
+)
+
+// defaultNamespace keeps the control and definition keys of backends without a key prefix off the root of the keyspace
+const defaultNamespace = "reter"
+
+type Backend struct {
+	client *etcd.Client
+	prefix string
+}
+
+// New creates a backend on top of the given client. Without a key prefix the state is kept at the bare task name
+// as in older versions, with a prefix all keys live under "<prefix>/tasks/<name>/" and "<prefix>/locks/<name>".
+// The control and definition keys live under "<prefix>/", or under "reter/" without a prefix.
+func New(client *etcd.Client, keyPrefix ...string) *Backend {
+	var prefix string
+	if len(keyPrefix) != 0 {
+		prefix = strings.TrimSuffix(keyPrefix[0], "/")
+	}
+
+	return &Backend{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+// namespace returns the key prefix, or the default namespace if it is not set
+func (b *Backend) namespace() string {
+	if b.prefix == "" {
+		return defaultNamespace
+	}
+	return b.prefix
+}
+
+func (b *Backend) Acquire(ctx context.Context, taskName string, ttl time.Duration) (backend.Lock, error) {
+	return newLock(ctx, b.client, b.lockKey(taskName), int(ttl.Seconds()))
+}
+
+// LockHolder returns the lease ID of the session holding the lock in hex, as it is written in the mutex key
+func (b *Backend) LockHolder(ctx context.Context, taskName string) (string, error) {
+	prefix := b.lockKey(taskName) + "/"
+
+	// the mutex is held by the session whose key has been created first
+	res, err := b.client.Get(ctx, prefix, etcd.WithFirstCreate()...)
+	if err != nil {
+		return "", err
+	}
+	if len(res.Kvs) == 0 {
+		return "", nil
+	}
+	return strings.TrimPrefix(string(res.Kvs[0].Key), prefix), nil
+}
+
+// GetLastActionTime reads the state record, plain timestamps written by older versions are parsed as well
+func (b *Backend) GetLastActionTime(ctx context.Context, taskName string) (*time.Time, error) {
+	state, _, err := b.getState(ctx, taskName)
+	if err != nil {
+		return nil, err
+	}
+	return state.LastAction, nil
+}
+
+func (b *Backend) SetLastActionTime(ctx context.Context, taskName string, t time.Time) error {
+	err := b.UpdateState(ctx, taskName, func(state models.State) models.State {
+		state.LastAction = &t
+		return state
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set last action time: %w", err)
+	}
+	return nil
+}
+
+// Claim reads the state record and puts the new last action time in a transaction comparing the key mod revision,
+// so the put fails if another node has claimed the slot after the read
+func (b *Backend) Claim(ctx context.Context, taskName string, t time.Time, isDue func(lastActionTime *time.Time) bool) (bool, *time.Time, error) {
+	state, revision, err := b.getState(ctx, taskName)
+	if err != nil {
+		return false, nil, err
+	}
+
+	previous := state.LastAction
+	if !isDue(previous) {
+		return false, previous, nil
+	}
+
+	state.LastAction = &t
+	claimed, err := b.putState(ctx, taskName, state, revision)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to claim last action time: %w", err)
+	}
+	return claimed, previous, nil
+}
+
+// Unclaim restores the previous last action time, the other fields of the record are kept
+func (b *Backend) Unclaim(ctx context.Context, taskName string, claimed time.Time, previous *time.Time) error {
+	for {
+		state, revision, err := b.getState(ctx, taskName)
+		if err != nil {
+			return err
+		}
+		if state.LastAction == nil || !state.LastAction.Equal(claimed) {
+			return nil
+		}
+
+		state.LastAction = previous
+		ok, err := b.putState(ctx, taskName, state, revision)
+		if err != nil {
+			return fmt.Errorf("failed to unclaim last action time: %w", err)
+		}
+		if ok {
+			return nil
+		}
+	}
+}
+
+func (b *Backend) SetLastFailure(ctx context.Context, taskName string, failure models.Failure) error {
+	data, err := json.Marshal(failure)
+	if err != nil {
+		return fmt.Errorf("failed to marshal last failure: %w", err)
+	}
+
+	if _, err := b.client.Put(ctx, b.failureKey(taskName), string(data)); err != nil {
+		return fmt.Errorf("failed to set last failure: %w", err)
+	}
+	return nil
+}
+
+// MigrateKeys moves the state and the execution history of the given tasks from the bare keys of older versions
+// to the prefixed layout, keys which already exist in the prefixed layout are not overwritten. Locks are not moved since they expire
+// with their leases, so nodes of the old and the new versions should not run at the same time.
+func (b *Backend) MigrateKeys(ctx context.Context, taskNames ...string) error {
+	if b.prefix == "" {
+		return fmt.Errorf("key prefix is not set")
+	}
+
+	legacy := New(b.client)
+	for _, taskName := range taskNames {
+		if err := b.moveKey(ctx, legacy.lastActionKey(taskName), b.lastActionKey(taskName)); err != nil {
+			return fmt.Errorf("failed to migrate last action time of %s: %w", taskName, err)
+		}
+		if err := b.moveKey(ctx, legacy.failureKey(taskName), b.failureKey(taskName)); err != nil {
+			return fmt.Errorf("failed to migrate last failure of %s: %w", taskName, err)
+		}
+		if err := b.movePrefix(ctx, legacy.historyPrefix(taskName), b.historyPrefix(taskName)); err != nil {
+			return fmt.Errorf("failed to migrate history of %s: %w", taskName, err)
+		}
+	}
+	return nil
+}
+
+func (b *Backend) moveKey(ctx context.Context, from, to string) error {
+	res, err := b.client.Get(ctx, from)
+	if err != nil {
+		return err
+	}
+	if len(res.Kvs) == 0 {
+		return nil
+	}
+	return b.moveValue(ctx, from, to, res.Kvs[0].Value, res.Kvs[0].ModRevision)
+}
+
+// movePrefix moves every key under the prefix like moveKey, the rest of the key is kept
+func (b *Backend) movePrefix(ctx context.Context, from, to string) error {
+	res, err := b.client.Get(ctx, from, etcd.WithPrefix())
+	if err != nil {
+		return err
+	}
+
+	for _, kv := range res.Kvs {
+		key := string(kv.Key)
+		if err := b.moveValue(ctx, key, to+strings.TrimPrefix(key, from), kv.Value, kv.ModRevision); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveValue puts the value read from the key at the target and deletes the key,
+// unless the key has changed since or the target exists already
+func (b *Backend) moveValue(ctx context.Context, from, to string, value []byte, modRevision int64) error {
+	_, err := b.client.Txn(ctx).
+		If(
+			etcd.Compare(etcd.ModRevision(from), "=", modRevision),
+			etcd.Compare(etcd.CreateRevision(to), "=", 0),
+		).
+		Then(etcd.OpPut(to, string(value)), etcd.OpDelete(from)).
+		Commit()
+	return err
+}
+
+func (b *Backend) lastActionKey(taskName string) string {
+	if b.prefix == "" {
+		return taskName
+	}
+	return b.prefix + "/tasks/" + taskName + "/last"
+}
+
+func (b *Backend) lockKey(taskName string) string {
+	if b.prefix == "" {
+		return taskName + "/lock"
+	}
+	return b.prefix + "/locks/" + taskName
+}
+
+func (b *Backend) failureKey(taskName string) string {
+	if b.prefix == "" {
+		return taskName + "/failure"
+	}
+	return b.prefix + "/tasks/" + taskName + "/failure"
+}
@@ -0,0 +1,300 @@
+package etcdbackend
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	etcd "go.etcd.io/etcd/client/v3"
+
+	"github.com/skvoch/reter/scheduler/models"
+)
+
+// openClient connects to the cluster from RETER_ETCD_ENDPOINTS (comma separated), an in-process fake is used if it is not set
+func openClient(t *testing.T) *etcd.Client {
+	endpoints := os.Getenv("RETER_ETCD_ENDPOINTS")
+	if endpoints == "" {
+		return newFakeClient(t)
+	}
+
+	client, err := etcd.New(etcd.Config{
+		Endpoints:   strings.Split(endpoints, ","),
+		DialTimeout: time.Second * 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return client
+}
+
+// testPrefix is unique for every test, the keys under it are deleted after the test
+func testPrefix(t *testing.T, client *etcd.Client) string {
+	prefix := "/reter-test/" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	t.Cleanup(func() {
+		_, _ = client.Delete(context.Background(), prefix+"/", etcd.WithPrefix())
+	})
+	return prefix
+}
+
+func makeBackend(t *testing.T) *Backend {
+	client := openClient(t)
+	return New(client, testPrefix(t, client))
+}
+
+func TestKeys(t *testing.T) {
+	cases := []struct {
+		Name       string
+		Prefix     []string
+		LastAction string
+		Lock       string
+		Failure    string
+		Paused     string
+		Definition string
+		History    string
+	}{
+		{
+			Name:       "#1 without prefix",
+			LastAction: "task",
+			Lock:       "task/lock",
+			Failure:    "task/failure",
+			Paused:     "reter/control/task/paused",
+			Definition: "reter/definitions/task",
+			History:    "task/history/",
+		},
+		{
+			Name:       "#2 with prefix",
+			Prefix:     []string{"/reter/billing"},
+			LastAction: "/reter/billing/tasks/task/last",
+			Lock:       "/reter/billing/locks/task",
+			Failure:    "/reter/billing/tasks/task/failure",
+			Paused:     "/reter/billing/control/task/paused",
+			Definition: "/reter/billing/definitions/task",
+			History:    "/reter/billing/tasks/task/history/",
+		},
+		{
+			Name:       "#3 with trailing slash",
+			Prefix:     []string{"/reter/billing/"},
+			LastAction: "/reter/billing/tasks/task/last",
+			Lock:       "/reter/billing/locks/task",
+			Failure:    "/reter/billing/tasks/task/failure",
+			Paused:     "/reter/billing/control/task/paused",
+			Definition: "/reter/billing/definitions/task",
+			History:    "/reter/billing/tasks/task/history/",
+		},
+		{
+			Name:       "#4 with empty prefix",
+			Prefix:     []string{""},
+			LastAction: "task",
+			Lock:       "task/lock",
+			Failure:    "task/failure",
+			Paused:     "reter/control/task/paused",
+			Definition: "reter/definitions/task",
+			History:    "task/history/",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			b := New(nil, c.Prefix...)
+
+			assert.Equal(t, c.LastAction, b.lastActionKey("task"))
+			assert.Equal(t, c.Lock, b.lockKey("task"))
+			assert.Equal(t, c.Failure, b.failureKey("task"))
+			assert.Equal(t, c.Paused, b.controlKey("task", controlPaused))
+
+			taskName, kind := b.parseControlKey(c.Paused)
+			assert.Equal(t, "task", taskName)
+			assert.Equal(t, controlPaused, kind)
+
+			assert.Equal(t, c.Definition, b.definitionKey("task"))
+			assert.Equal(t, "task", b.parseDefinitionKey(c.Definition))
+			assert.Equal(t, c.History, b.historyPrefix("task"))
+		})
+	}
+}
+
+func TestParseState(t *testing.T) {
+	last := time.Date(2021, 6, 1, 3, 0, 0, 0, time.UTC)
+	lastNano := time.Date(2021, 6, 1, 3, 0, 0, 123456789, time.UTC)
+
+	cases := []struct {
+		Name     string
+		Value    string
+		Expected models.State
+		IsValid  bool
+	}{
+		{
+			Name:     "#1 legacy timestamp",
+			Value:    "2021-06-01T03:00:00Z",
+			Expected: models.State{LastAction: &last},
+			IsValid:  true,
+		},
+		{
+			Name:     "#2 legacy timestamp with nanoseconds",
+			Value:    "2021-06-01T03:00:00.123456789Z",
+			Expected: models.State{LastAction: &lastNano},
+			IsValid:  true,
+		},
+		{
+			Name:  "#3 record",
+			Value: `{"version":1,"last_action":"2021-06-01T03:00:00Z","last_start":"2021-06-01T03:00:00Z","consecutive_failures":2,"node_id":"node","run_id":"run"}`,
+			Expected: models.State{
+				Version:             1,
+				LastAction:          &last,
+				LastStart:           &last,
+				ConsecutiveFailures: 2,
+				NodeID:              "node",
+				RunID:               "run",
+			},
+			IsValid: true,
+		},
+		{
+			Name:    "#4 malformed record",
+			Value:   `{"version":1`,
+			IsValid: false,
+		},
+		{
+			Name:    "#5 malformed timestamp",
+			Value:   "yesterday",
+			IsValid: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			state, err := parseState([]byte(c.Value))
+			if !c.IsValid {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.Expected, state)
+		})
+	}
+}
+
+func TestClaim(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		b        = makeBackend(t)
+		previous = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+		slot     = previous.Add(time.Minute)
+		claimed  int32
+		read     sync.WaitGroup
+		wg       sync.WaitGroup
+	)
+	assert.NoError(t, b.SetLastActionTime(ctx, "task", previous))
+
+	isDue := func(lastActionTime *time.Time) bool {
+		return lastActionTime == nil || lastActionTime.Before(slot)
+	}
+
+	// nodes which have read the same last action time claim the slot at once, only one of them gets it
+	read.Add(10)
+	for n := 0; n < 10; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ok, last, err := b.Claim(ctx, "task", slot, func(lastActionTime *time.Time) bool {
+				read.Done()
+				read.Wait()
+				return isDue(lastActionTime)
+			})
+			assert.NoError(t, err)
+			if ok {
+				atomic.AddInt32(&claimed, 1)
+				assert.True(t, previous.Equal(*last))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), claimed)
+
+	last, err := b.GetLastActionTime(ctx, "task")
+	assert.NoError(t, err)
+	assert.True(t, slot.Equal(*last))
+
+	// a claim of another slot is kept
+	assert.NoError(t, b.Unclaim(ctx, "task", previous, nil))
+	last, err = b.GetLastActionTime(ctx, "task")
+	assert.NoError(t, err)
+	assert.True(t, slot.Equal(*last))
+
+	assert.NoError(t, b.Unclaim(ctx, "task", slot, &previous))
+	last, err = b.GetLastActionTime(ctx, "task")
+	assert.NoError(t, err)
+	assert.True(t, previous.Equal(*last))
+
+	// the first claim of a task is reverted to no last action time
+	ok, last, err := b.Claim(ctx, "new", slot, isDue)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Nil(t, last)
+
+	assert.NoError(t, b.Unclaim(ctx, "new", slot, nil))
+	last, err = b.GetLastActionTime(ctx, "new")
+	assert.NoError(t, err)
+	assert.Nil(t, last)
+}
+
+func TestMigrateKeys(t *testing.T) {
+	ctx := context.Background()
+	client := openClient(t)
+	b := New(client, testPrefix(t, client))
+
+	// the keys of older versions live at the bare task names
+	taskName := "reter-test-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	existing := taskName + "-existing"
+	t.Cleanup(func() {
+		_, _ = client.Delete(context.Background(), taskName, etcd.WithPrefix())
+	})
+
+	legacy := New(client)
+	last := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	_, err := client.Put(ctx, legacy.lastActionKey(taskName), last.Format(time.RFC3339))
+	assert.NoError(t, err)
+	assert.NoError(t, legacy.SetLastFailure(ctx, taskName, models.Failure{Time: last, Outcome: models.OutcomeFailed}))
+	assert.NoError(t, legacy.AddExecution(ctx, taskName, models.Execution{Start: last, End: last, NodeID: "node"}, models.Retention{}))
+
+	assert.NoError(t, legacy.SetLastActionTime(ctx, existing, last))
+	newer := last.Add(time.Hour)
+	assert.NoError(t, b.SetLastActionTime(ctx, existing, newer))
+
+	assert.NoError(t, b.MigrateKeys(ctx, taskName, existing))
+
+	moved, err := b.GetLastActionTime(ctx, taskName)
+	assert.NoError(t, err)
+	assert.True(t, last.Equal(*moved))
+
+	res, err := client.Get(ctx, b.failureKey(taskName))
+	assert.NoError(t, err)
+	assert.Len(t, res.Kvs, 1)
+
+	history, err := b.History(ctx, taskName, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 1) {
+		assert.True(t, last.Equal(history[0].Start))
+	}
+
+	res, err = client.Get(ctx, taskName, etcd.WithPrefix(), etcd.WithCountOnly())
+	assert.NoError(t, err)
+	// the key of the existing task is not moved
+	assert.Equal(t, int64(1), res.Count)
+
+	kept, err := b.GetLastActionTime(ctx, existing)
+	assert.NoError(t, err)
+	assert.True(t, newer.Equal(*kept))
+
+	assert.Error(t, legacy.MigrateKeys(ctx, taskName))
+}
@@ -0,0 +1,168 @@
+package etcdbackend
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	etcd "go.etcd.io/etcd/client/v3"
+
+	"github.com/skvoch/reter/scheduler/backend"
+)
+
+const (
+	controlPaused  = "paused"
+	controlTrigger = "trigger"
+)
+
+// Pause pauses the task on all nodes until it is resumed, the key can be put with etcdctl as well
+func (b *Backend) Pause(ctx context.Context, taskName string) error {
+	if _, err := b.client.Put(ctx, b.controlKey(taskName, controlPaused), "true"); err != nil {
+		return fmt.Errorf("failed to pause task: %w", err)
+	}
+	return nil
+}
+
+func (b *Backend) Resume(ctx context.Context, taskName string) error {
+	if _, err := b.client.Delete(ctx, b.controlKey(taskName, controlPaused)); err != nil {
+		return fmt.Errorf("failed to resume task: %w", err)
+	}
+	return nil
+}
+
+// Trigger makes exactly one node running the task run it right away
+func (b *Backend) Trigger(ctx context.Context, taskName string) error {
+	if _, err := b.client.Put(ctx, b.controlKey(taskName, controlTrigger), "true"); err != nil {
+		return fmt.Errorf("failed to trigger task: %w", err)
+	}
+	return nil
+}
+
+// WatchControl reads the control keys and watches them. A task is paused while its "paused" key exists,
+// a put of its "trigger" key is claimed by deleting the key in a transaction, so only one node runs it.
+// Triggers of tasks the node does not run are left for the nodes which do or start them later.
+func (b *Backend) WatchControl(ctx context.Context, handler backend.ControlHandler) error {
+	paused := make(map[string]bool)
+
+	for {
+		res, err := b.client.Get(ctx, b.controlPrefix(), etcd.WithPrefix())
+		if err != nil {
+			return fmt.Errorf("failed to get control keys: %w", err)
+		}
+
+		// the state is read again after the watch has been interrupted, so missed deletions are applied too
+		current := make(map[string]bool)
+		for _, kv := range res.Kvs {
+			if taskName, kind := b.parseControlKey(string(kv.Key)); kind == controlPaused {
+				current[taskName] = true
+			}
+		}
+		for taskName := range paused {
+			if !current[taskName] {
+				handler.SetPaused(taskName, false)
+			}
+		}
+		for taskName := range current {
+			handler.SetPaused(taskName, true)
+		}
+		paused = current
+
+		for _, kv := range res.Kvs {
+			if err := b.handleTrigger(ctx, handler, string(kv.Key), kv.ModRevision); err != nil {
+				return err
+			}
+		}
+
+		watch := b.client.Watch(ctx, b.controlPrefix(), etcd.WithPrefix(), etcd.WithRev(res.Header.Revision+1))
+		for resp := range watch {
+			if resp.Err() != nil {
+				break
+			}
+
+			for _, event := range resp.Events {
+				taskName, kind := b.parseControlKey(string(event.Kv.Key))
+
+				switch {
+				case kind == controlPaused:
+					isPaused := event.Type == etcd.EventTypePut
+					if isPaused {
+						paused[taskName] = true
+					} else {
+						delete(paused, taskName)
+					}
+					handler.SetPaused(taskName, isPaused)
+
+				case kind == controlTrigger && event.Type == etcd.EventTypePut:
+					if err := b.handleTrigger(ctx, handler, string(event.Kv.Key), event.Kv.ModRevision); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// ClaimTrigger claims the trigger key left by a put while no node was running the task
+func (b *Backend) ClaimTrigger(ctx context.Context, taskName string) (bool, error) {
+	key := b.controlKey(taskName, controlTrigger)
+
+	res, err := b.client.Get(ctx, key)
+	if err != nil {
+		return false, fmt.Errorf("failed to get trigger: %w", err)
+	}
+	if len(res.Kvs) == 0 {
+		return false, nil
+	}
+	return b.claimTrigger(ctx, key, res.Kvs[0].ModRevision)
+}
+
+// handleTrigger claims the trigger by deleting its key unless it has been deleted or put again since the given revision
+func (b *Backend) handleTrigger(ctx context.Context, handler backend.ControlHandler, key string, revision int64) error {
+	taskName, kind := b.parseControlKey(key)
+	if kind != controlTrigger || !handler.HasTask(taskName) {
+		return nil
+	}
+
+	claimed, err := b.claimTrigger(ctx, key, revision)
+	if err != nil {
+		return err
+	}
+	if claimed {
+		handler.Trigger(taskName)
+	}
+	return nil
+}
+
+func (b *Backend) claimTrigger(ctx context.Context, key string, revision int64) (bool, error) {
+	txn, err := b.client.Txn(ctx).
+		If(etcd.Compare(etcd.ModRevision(key), "=", revision)).
+		Then(etcd.OpDelete(key)).
+		Commit()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim trigger: %w", err)
+	}
+	return txn.Succeeded, nil
+}
+
+func (b *Backend) controlPrefix() string {
+	return b.namespace() + "/control/"
+}
+
+func (b *Backend) controlKey(taskName, kind string) string {
+	return b.controlPrefix() + taskName + "/" + kind
+}
+
+// parseControlKey splits "<prefix>/control/<name>/<kind>" into the task name and the kind of the key
+func (b *Backend) parseControlKey(key string) (string, string) {
+	key = strings.TrimPrefix(key, b.controlPrefix())
+
+	idx := strings.LastIndexByte(key, '/')
+	if idx < 0 {
+		return "", ""
+	}
+	return key[:idx], key[idx+1:]
+}
@@ -0,0 +1,118 @@
+package etcdbackend
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// controlRecorder records the control commands passed to a node
+type controlRecorder struct {
+	mx       sync.Mutex
+	paused   map[string]bool
+	triggers int
+}
+
+func (r *controlRecorder) SetPaused(taskName string, paused bool) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	r.paused[taskName] = paused
+}
+
+func (r *controlRecorder) HasTask(taskName string) bool {
+	return taskName == "task"
+}
+
+func (r *controlRecorder) Trigger(string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	r.triggers++
+}
+
+func (r *controlRecorder) state() (bool, int) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	return r.paused["task"], r.triggers
+}
+
+func TestWatchControl(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := makeBackend(t)
+	assert.NoError(t, b.Pause(ctx, "task"))
+
+	// two nodes running the task
+	nodes := []*controlRecorder{
+		{paused: make(map[string]bool)},
+		{paused: make(map[string]bool)},
+	}
+	var wg sync.WaitGroup
+	for _, node := range nodes {
+		node := node
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.ErrorIs(t, b.WatchControl(ctx, node), context.Canceled)
+		}()
+	}
+
+	isPaused := func(expected bool) func() bool {
+		return func() bool {
+			for _, node := range nodes {
+				if paused, _ := node.state(); paused != expected {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	assert.Eventually(t, isPaused(true), time.Second*5, time.Millisecond*10)
+
+	assert.NoError(t, b.Resume(ctx, "task"))
+	assert.Eventually(t, isPaused(false), time.Second*5, time.Millisecond*10)
+
+	// the trigger is claimed by exactly one of the nodes
+	assert.NoError(t, b.Trigger(ctx, "task"))
+	triggers := func() int {
+		var out int
+		for _, node := range nodes {
+			_, n := node.state()
+			out += n
+		}
+		return out
+	}
+	assert.Eventually(t, func() bool {
+		return triggers() == 1
+	}, time.Second*5, time.Millisecond*10)
+
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, 1, triggers())
+
+	res, err := b.client.Get(ctx, b.controlKey("task", controlTrigger))
+	assert.NoError(t, err)
+	assert.Empty(t, res.Kvs)
+
+	// the trigger of a task no node runs is kept until it is claimed
+	assert.NoError(t, b.Trigger(ctx, "later"))
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, 1, triggers())
+
+	claimed, err := b.ClaimTrigger(ctx, "later")
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+
+	claimed, err = b.ClaimTrigger(ctx, "later")
+	assert.NoError(t, err)
+	assert.False(t, claimed)
+
+	cancel()
+	wg.Wait()
+}
@@ -0,0 +1,95 @@
+package etcdbackend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	etcd "go.etcd.io/etcd/client/v3"
+
+	"github.com/skvoch/reter/scheduler/backend"
+	"github.com/skvoch/reter/scheduler/models"
+)
+
+// PutDefinition stores the definition as JSON, YAML specs can be put with etcdctl as well
+func (b *Backend) PutDefinition(ctx context.Context, definition models.Definition) error {
+	data, err := json.Marshal(definition)
+	if err != nil {
+		return fmt.Errorf("failed to marshal definition: %w", err)
+	}
+
+	if _, err := b.client.Put(ctx, b.definitionKey(definition.Name), string(data)); err != nil {
+		return fmt.Errorf("failed to put definition: %w", err)
+	}
+	return nil
+}
+
+func (b *Backend) DeleteDefinition(ctx context.Context, name string) error {
+	if _, err := b.client.Delete(ctx, b.definitionKey(name)); err != nil {
+		return fmt.Errorf("failed to delete definition: %w", err)
+	}
+	return nil
+}
+
+// WatchDefinitions reads the keys under "<prefix>/definitions/" and watches them, the task name is the rest of the key
+func (b *Backend) WatchDefinitions(ctx context.Context, handler backend.DefinitionHandler) error {
+	known := make(map[string]bool)
+
+	for {
+		res, err := b.client.Get(ctx, b.definitionPrefix(), etcd.WithPrefix())
+		if err != nil {
+			return fmt.Errorf("failed to get definitions: %w", err)
+		}
+
+		// the definitions are read again after the watch has been interrupted, so missed deletions are applied too
+		current := make(map[string]bool)
+		for _, kv := range res.Kvs {
+			current[b.parseDefinitionKey(string(kv.Key))] = true
+		}
+		for name := range known {
+			if !current[name] {
+				handler.DeleteDefinition(name)
+			}
+		}
+		for _, kv := range res.Kvs {
+			handler.PutDefinition(b.parseDefinitionKey(string(kv.Key)), kv.Value)
+		}
+		known = current
+
+		watch := b.client.Watch(ctx, b.definitionPrefix(), etcd.WithPrefix(), etcd.WithRev(res.Header.Revision+1))
+		for resp := range watch {
+			if resp.Err() != nil {
+				break
+			}
+
+			for _, event := range resp.Events {
+				name := b.parseDefinitionKey(string(event.Kv.Key))
+
+				if event.Type == etcd.EventTypePut {
+					known[name] = true
+					handler.PutDefinition(name, event.Kv.Value)
+				} else {
+					delete(known, name)
+					handler.DeleteDefinition(name)
+				}
+			}
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+func (b *Backend) definitionPrefix() string {
+	return b.namespace() + "/definitions/"
+}
+
+func (b *Backend) definitionKey(name string) string {
+	return b.definitionPrefix() + name
+}
+
+func (b *Backend) parseDefinitionKey(key string) string {
+	return strings.TrimPrefix(key, b.definitionPrefix())
+}
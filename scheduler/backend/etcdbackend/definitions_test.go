@@ -0,0 +1,86 @@
+package etcdbackend
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skvoch/reter/scheduler/models"
+)
+
+// definitionRecorder records the definitions passed to a node
+type definitionRecorder struct {
+	mx          sync.Mutex
+	definitions map[string]string
+}
+
+func (r *definitionRecorder) PutDefinition(name string, spec []byte) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	r.definitions[name] = string(spec)
+}
+
+func (r *definitionRecorder) DeleteDefinition(name string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	delete(r.definitions, name)
+}
+
+func (r *definitionRecorder) get(name string) (models.Definition, bool) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	spec, ok := r.definitions[name]
+	if !ok {
+		return models.Definition{}, false
+	}
+	out, _ := models.ParseDefinition([]byte(spec))
+	return out, true
+}
+
+func TestWatchDefinitions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := makeBackend(t)
+	report := models.Definition{Name: "report", Cron: "0 9 * * MON", Handler: "send-report"}
+	assert.NoError(t, b.PutDefinition(ctx, report))
+
+	recorder := &definitionRecorder{definitions: make(map[string]string)}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.ErrorIs(t, b.WatchDefinitions(ctx, recorder), context.Canceled)
+	}()
+
+	hasDefinition := func(name string, expected models.Definition) func() bool {
+		return func() bool {
+			out, ok := recorder.get(name)
+			return ok && reflect.DeepEqual(out, expected)
+		}
+	}
+	assert.Eventually(t, hasDefinition("report", report), time.Second*5, time.Millisecond*10)
+
+	cleanup := models.Definition{Name: "cleanup", Interval: "10m", Handler: "cleanup"}
+	assert.NoError(t, b.PutDefinition(ctx, cleanup))
+	assert.Eventually(t, hasDefinition("cleanup", cleanup), time.Second*5, time.Millisecond*10)
+
+	report.Cron = "0 10 * * MON"
+	assert.NoError(t, b.PutDefinition(ctx, report))
+	assert.Eventually(t, hasDefinition("report", report), time.Second*5, time.Millisecond*10)
+
+	assert.NoError(t, b.DeleteDefinition(ctx, "report"))
+	assert.Eventually(t, func() bool {
+		_, ok := recorder.get("report")
+		return !ok
+	}, time.Second*5, time.Millisecond*10)
+
+	cancel()
+	<-done
+}
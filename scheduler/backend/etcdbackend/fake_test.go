@@ -0,0 +1,669 @@
+package etcdbackend
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	etcd "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
+)
+
+// fakeServer is an in-process etcd serving the KV, lease and watch requests of the client,
+// the tests are run against it if RETER_ETCD_ENDPOINTS is not set
+type fakeServer struct {
+	mx        sync.Mutex
+	revision  int64
+	kvs       map[string]*mvccpb.KeyValue
+	events    []*mvccpb.Event
+	leases    map[int64]*fakeLease
+	lastLease int64
+	watches   map[*fakeWatchStream]struct{}
+	closed    bool
+}
+
+type fakeLease struct {
+	ttl    int64
+	expiry time.Time
+	timer  *time.Timer
+	keys   map[string]struct{}
+}
+
+// newFakeClient returns a client of a new fake server, the server is stopped after the test
+func newFakeClient(t *testing.T) *etcd.Client {
+	s := &fakeServer{
+		revision: 1,
+		kvs:      make(map[string]*mvccpb.KeyValue),
+		leases:   make(map[int64]*fakeLease),
+		watches:  make(map[*fakeWatchStream]struct{}),
+	}
+
+	client := etcd.NewCtxClient(context.Background())
+	client.KV = etcd.NewKVFromKVClient(s, client)
+	client.Lease = etcd.NewLeaseFromLeaseClient(s, client, time.Second*5)
+	client.Watcher = etcd.NewWatchFromWatchClient(s, client)
+
+	t.Cleanup(func() {
+		_ = client.Close()
+		s.close()
+	})
+	return client
+}
+
+func (s *fakeServer) close() {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.closed = true
+	for _, lease := range s.leases {
+		lease.timer.Stop()
+	}
+}
+
+func (s *fakeServer) header() *pb.ResponseHeader {
+	return &pb.ResponseHeader{ClusterId: 1, MemberId: 1, RaftTerm: 1, Revision: s.revision}
+}
+
+// inRange follows the etcd range semantics: an empty end is a single key, "\x00" is every key from the start
+func inRange(key, start, end []byte) bool {
+	switch {
+	case len(end) == 0:
+		return bytes.Equal(key, start)
+	case bytes.Equal(end, []byte{0}):
+		return bytes.Compare(key, start) >= 0
+	}
+	return bytes.Compare(key, start) >= 0 && bytes.Compare(key, end) < 0
+}
+
+func (s *fakeServer) keys(start, end []byte) []*mvccpb.KeyValue {
+	var out []*mvccpb.KeyValue
+	for _, kv := range s.kvs {
+		if inRange(kv.Key, start, end) {
+			out = append(out, kv)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return bytes.Compare(out[i].Key, out[j].Key) < 0
+	})
+	return out
+}
+
+func (s *fakeServer) Range(ctx context.Context, r *pb.RangeRequest, _ ...grpc.CallOption) (*pb.RangeResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return s.rangeKeys(r), nil
+}
+
+func (s *fakeServer) rangeKeys(r *pb.RangeRequest) *pb.RangeResponse {
+	var kvs []*mvccpb.KeyValue
+	for _, kv := range s.keys(r.Key, r.RangeEnd) {
+		if (r.MinModRevision > 0 && kv.ModRevision < r.MinModRevision) ||
+			(r.MaxModRevision > 0 && kv.ModRevision > r.MaxModRevision) ||
+			(r.MinCreateRevision > 0 && kv.CreateRevision < r.MinCreateRevision) ||
+			(r.MaxCreateRevision > 0 && kv.CreateRevision > r.MaxCreateRevision) {
+			continue
+		}
+		kvs = append(kvs, kv)
+	}
+
+	order := r.SortOrder
+	if order == pb.RangeRequest_NONE && r.SortTarget != pb.RangeRequest_KEY {
+		order = pb.RangeRequest_ASCEND
+	}
+	if order != pb.RangeRequest_NONE {
+		less := func(a, b *mvccpb.KeyValue) bool {
+			switch r.SortTarget {
+			case pb.RangeRequest_VERSION:
+				return a.Version < b.Version
+			case pb.RangeRequest_CREATE:
+				return a.CreateRevision < b.CreateRevision
+			case pb.RangeRequest_MOD:
+				return a.ModRevision < b.ModRevision
+			case pb.RangeRequest_VALUE:
+				return bytes.Compare(a.Value, b.Value) < 0
+			}
+			return bytes.Compare(a.Key, b.Key) < 0
+		}
+		sort.SliceStable(kvs, func(i, j int) bool {
+			if order == pb.RangeRequest_DESCEND {
+				return less(kvs[j], kvs[i])
+			}
+			return less(kvs[i], kvs[j])
+		})
+	}
+
+	res := &pb.RangeResponse{Header: s.header(), Count: int64(len(kvs))}
+	if r.Limit > 0 && int64(len(kvs)) > r.Limit {
+		kvs = kvs[:r.Limit]
+		res.More = true
+	}
+	if r.CountOnly {
+		return res
+	}
+	for _, kv := range kvs {
+		c := *kv
+		if r.KeysOnly {
+			c.Value = nil
+		}
+		res.Kvs = append(res.Kvs, &c)
+	}
+	return res
+}
+
+func (s *fakeServer) Put(ctx context.Context, r *pb.PutRequest, _ ...grpc.CallOption) (*pb.PutResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	res, err := s.put(r, s.revision+1)
+	if err != nil {
+		return nil, err
+	}
+	s.revision++
+	res.Header = s.header()
+	return res, nil
+}
+
+func (s *fakeServer) put(r *pb.PutRequest, revision int64) (*pb.PutResponse, error) {
+	var lease *fakeLease
+	if r.Lease != 0 {
+		var ok bool
+		if lease, ok = s.leases[r.Lease]; !ok {
+			return nil, rpctypes.ErrGRPCLeaseNotFound
+		}
+	}
+
+	res := &pb.PutResponse{}
+	kv := &mvccpb.KeyValue{Key: r.Key, Value: r.Value, CreateRevision: revision, ModRevision: revision, Version: 1, Lease: r.Lease}
+	if prev, ok := s.kvs[string(r.Key)]; ok {
+		if r.PrevKv {
+			c := *prev
+			res.PrevKv = &c
+		}
+		if old, ok := s.leases[prev.Lease]; ok {
+			delete(old.keys, string(r.Key))
+		}
+		kv.CreateRevision = prev.CreateRevision
+		kv.Version = prev.Version + 1
+	}
+	if lease != nil {
+		lease.keys[string(r.Key)] = struct{}{}
+	}
+
+	s.kvs[string(r.Key)] = kv
+	c := *kv
+	s.emit(&mvccpb.Event{Type: mvccpb.PUT, Kv: &c})
+	return res, nil
+}
+
+func (s *fakeServer) DeleteRange(ctx context.Context, r *pb.DeleteRangeRequest, _ ...grpc.CallOption) (*pb.DeleteRangeResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	res := s.deleteRange(r, s.revision+1)
+	if res.Deleted > 0 {
+		s.revision++
+	}
+	res.Header = s.header()
+	return res, nil
+}
+
+func (s *fakeServer) deleteRange(r *pb.DeleteRangeRequest, revision int64) *pb.DeleteRangeResponse {
+	res := &pb.DeleteRangeResponse{}
+	for _, kv := range s.keys(r.Key, r.RangeEnd) {
+		s.deleteKey(kv, revision)
+		if r.PrevKv {
+			res.PrevKvs = append(res.PrevKvs, kv)
+		}
+		res.Deleted++
+	}
+	return res
+}
+
+func (s *fakeServer) deleteKey(kv *mvccpb.KeyValue, revision int64) {
+	delete(s.kvs, string(kv.Key))
+	if lease, ok := s.leases[kv.Lease]; ok {
+		delete(lease.keys, string(kv.Key))
+	}
+	s.emit(&mvccpb.Event{Type: mvccpb.DELETE, Kv: &mvccpb.KeyValue{Key: kv.Key, ModRevision: revision}})
+}
+
+func (s *fakeServer) Txn(ctx context.Context, r *pb.TxnRequest, _ ...grpc.CallOption) (*pb.TxnResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	revision := s.revision + 1
+	res, changed, err := s.txn(r, revision)
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		s.revision = revision
+	}
+	res.Header = s.header()
+	return res, nil
+}
+
+func (s *fakeServer) txn(r *pb.TxnRequest, revision int64) (*pb.TxnResponse, bool, error) {
+	succeeded := true
+	for _, cmp := range r.Compare {
+		succeeded = succeeded && s.compare(cmp)
+	}
+
+	ops := r.Failure
+	if succeeded {
+		ops = r.Success
+	}
+
+	var changed bool
+	res := &pb.TxnResponse{Succeeded: succeeded}
+	for _, op := range ops {
+		switch req := op.Request.(type) {
+		case *pb.RequestOp_RequestRange:
+			res.Responses = append(res.Responses, &pb.ResponseOp{Response: &pb.ResponseOp_ResponseRange{
+				ResponseRange: s.rangeKeys(req.RequestRange),
+			}})
+		case *pb.RequestOp_RequestPut:
+			put, err := s.put(req.RequestPut, revision)
+			if err != nil {
+				return nil, false, err
+			}
+			changed = true
+			res.Responses = append(res.Responses, &pb.ResponseOp{Response: &pb.ResponseOp_ResponsePut{ResponsePut: put}})
+		case *pb.RequestOp_RequestDeleteRange:
+			del := s.deleteRange(req.RequestDeleteRange, revision)
+			changed = changed || del.Deleted > 0
+			res.Responses = append(res.Responses, &pb.ResponseOp{Response: &pb.ResponseOp_ResponseDeleteRange{ResponseDeleteRange: del}})
+		case *pb.RequestOp_RequestTxn:
+			txn, txnChanged, err := s.txn(req.RequestTxn, revision)
+			if err != nil {
+				return nil, false, err
+			}
+			changed = changed || txnChanged
+			res.Responses = append(res.Responses, &pb.ResponseOp{Response: &pb.ResponseOp_ResponseTxn{ResponseTxn: txn}})
+		}
+	}
+	return res, changed, nil
+}
+
+func (s *fakeServer) compare(cmp *pb.Compare) bool {
+	kv, ok := s.kvs[string(cmp.Key)]
+	if !ok {
+		kv = &mvccpb.KeyValue{}
+	}
+
+	var result int
+	switch target := cmp.TargetUnion.(type) {
+	case *pb.Compare_Version:
+		result = compareInt(kv.Version, target.Version)
+	case *pb.Compare_CreateRevision:
+		result = compareInt(kv.CreateRevision, target.CreateRevision)
+	case *pb.Compare_ModRevision:
+		result = compareInt(kv.ModRevision, target.ModRevision)
+	case *pb.Compare_Lease:
+		result = compareInt(kv.Lease, target.Lease)
+	case *pb.Compare_Value:
+		if !ok {
+			return false
+		}
+		result = bytes.Compare(kv.Value, target.Value)
+	}
+
+	switch cmp.Result {
+	case pb.Compare_EQUAL:
+		return result == 0
+	case pb.Compare_NOT_EQUAL:
+		return result != 0
+	case pb.Compare_GREATER:
+		return result > 0
+	case pb.Compare_LESS:
+		return result < 0
+	}
+	return false
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (s *fakeServer) Compact(context.Context, *pb.CompactionRequest, ...grpc.CallOption) (*pb.CompactionResponse, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return &pb.CompactionResponse{Header: s.header()}, nil
+}
+
+// emit keeps the event for the watches created later and passes it to the current ones
+func (s *fakeServer) emit(event *mvccpb.Event) {
+	s.events = append(s.events, event)
+	for stream := range s.watches {
+		stream.dispatch(event)
+	}
+}
+
+func (s *fakeServer) LeaseGrant(ctx context.Context, r *pb.LeaseGrantRequest, _ ...grpc.CallOption) (*pb.LeaseGrantResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	id := r.ID
+	if id == 0 {
+		s.lastLease++
+		id = s.lastLease
+	}
+	ttl := time.Duration(r.TTL) * time.Second
+
+	lease := &fakeLease{
+		ttl:    r.TTL,
+		expiry: time.Now().Add(ttl),
+		keys:   make(map[string]struct{}),
+	}
+	lease.timer = time.AfterFunc(ttl, func() {
+		s.expire(id)
+	})
+	s.leases[id] = lease
+
+	return &pb.LeaseGrantResponse{Header: s.header(), ID: id, TTL: r.TTL}, nil
+}
+
+func (s *fakeServer) expire(id int64) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	lease, ok := s.leases[id]
+	if !ok || s.closed {
+		return
+	}
+	// the lease has been kept alive after the timer fired
+	if remaining := time.Until(lease.expiry); remaining > 0 {
+		lease.timer.Reset(remaining)
+		return
+	}
+	s.revoke(id)
+}
+
+func (s *fakeServer) revoke(id int64) {
+	lease := s.leases[id]
+	lease.timer.Stop()
+	delete(s.leases, id)
+
+	if len(lease.keys) == 0 {
+		return
+	}
+	s.revision++
+	for key := range lease.keys {
+		s.deleteKey(s.kvs[key], s.revision)
+	}
+}
+
+func (s *fakeServer) LeaseRevoke(ctx context.Context, r *pb.LeaseRevokeRequest, _ ...grpc.CallOption) (*pb.LeaseRevokeResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if _, ok := s.leases[r.ID]; !ok {
+		return nil, rpctypes.ErrGRPCLeaseNotFound
+	}
+	s.revoke(r.ID)
+	return &pb.LeaseRevokeResponse{Header: s.header()}, nil
+}
+
+func (s *fakeServer) LeaseTimeToLive(ctx context.Context, r *pb.LeaseTimeToLiveRequest, _ ...grpc.CallOption) (*pb.LeaseTimeToLiveResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	lease, ok := s.leases[r.ID]
+	if !ok {
+		return &pb.LeaseTimeToLiveResponse{Header: s.header(), ID: r.ID, TTL: -1}, nil
+	}
+
+	res := &pb.LeaseTimeToLiveResponse{
+		Header:     s.header(),
+		ID:         r.ID,
+		TTL:        int64(time.Until(lease.expiry).Seconds()),
+		GrantedTTL: lease.ttl,
+	}
+	if r.Keys {
+		for key := range lease.keys {
+			res.Keys = append(res.Keys, []byte(key))
+		}
+	}
+	return res, nil
+}
+
+func (s *fakeServer) LeaseLeases(ctx context.Context, _ *pb.LeaseLeasesRequest, _ ...grpc.CallOption) (*pb.LeaseLeasesResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	res := &pb.LeaseLeasesResponse{Header: s.header()}
+	for id := range s.leases {
+		res.Leases = append(res.Leases, &pb.LeaseStatus{ID: id})
+	}
+	return res, nil
+}
+
+func (s *fakeServer) LeaseKeepAlive(ctx context.Context, _ ...grpc.CallOption) (pb.Lease_LeaseKeepAliveClient, error) {
+	return &fakeKeepAliveStream{s: s, ctx: ctx, queue: newFakeQueue()}, nil
+}
+
+// fakeKeepAliveStream answers the keep-alives with the ttl of the lease, 0 if it does not exist anymore
+type fakeKeepAliveStream struct {
+	pb.Lease_LeaseKeepAliveClient
+
+	s     *fakeServer
+	ctx   context.Context
+	queue *fakeQueue
+}
+
+func (k *fakeKeepAliveStream) Send(r *pb.LeaseKeepAliveRequest) error {
+	k.s.mx.Lock()
+	defer k.s.mx.Unlock()
+
+	res := &pb.LeaseKeepAliveResponse{Header: k.s.header(), ID: r.ID}
+	if lease, ok := k.s.leases[r.ID]; ok {
+		lease.expiry = time.Now().Add(time.Duration(lease.ttl) * time.Second)
+		res.TTL = lease.ttl
+	}
+	k.queue.push(res)
+	return nil
+}
+
+func (k *fakeKeepAliveStream) Recv() (*pb.LeaseKeepAliveResponse, error) {
+	res, err := k.queue.pop(k.ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*pb.LeaseKeepAliveResponse), nil
+}
+
+func (k *fakeKeepAliveStream) Context() context.Context {
+	return k.ctx
+}
+
+func (k *fakeKeepAliveStream) CloseSend() error {
+	return nil
+}
+
+func (s *fakeServer) Watch(ctx context.Context, _ ...grpc.CallOption) (pb.Watch_WatchClient, error) {
+	stream := &fakeWatchStream{
+		s:       s,
+		ctx:     ctx,
+		queue:   newFakeQueue(),
+		watches: make(map[int64]*pb.WatchCreateRequest),
+	}
+
+	s.mx.Lock()
+	s.watches[stream] = struct{}{}
+	s.mx.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		s.mx.Lock()
+		delete(s.watches, stream)
+		s.mx.Unlock()
+	}()
+	return stream, nil
+}
+
+// fakeWatchStream passes the events of its watches in the order of their revisions
+type fakeWatchStream struct {
+	pb.Watch_WatchClient
+
+	s         *fakeServer
+	ctx       context.Context
+	queue     *fakeQueue
+	watches   map[int64]*pb.WatchCreateRequest
+	lastWatch int64
+}
+
+func (w *fakeWatchStream) Send(r *pb.WatchRequest) error {
+	w.s.mx.Lock()
+	defer w.s.mx.Unlock()
+
+	switch req := r.RequestUnion.(type) {
+	case *pb.WatchRequest_CreateRequest:
+		id := w.lastWatch
+		w.lastWatch++
+
+		create := req.CreateRequest
+		w.queue.push(&pb.WatchResponse{Header: w.s.header(), WatchId: id, Created: true})
+		if create.StartRevision > 0 {
+			for _, event := range w.s.events {
+				if event.Kv.ModRevision >= create.StartRevision {
+					w.send(id, create, event)
+				}
+			}
+		}
+		w.watches[id] = create
+	case *pb.WatchRequest_CancelRequest:
+		delete(w.watches, req.CancelRequest.WatchId)
+		w.queue.push(&pb.WatchResponse{Header: w.s.header(), WatchId: req.CancelRequest.WatchId, Canceled: true})
+	case *pb.WatchRequest_ProgressRequest:
+		w.queue.push(&pb.WatchResponse{Header: w.s.header(), WatchId: -1})
+	}
+	return nil
+}
+
+func (w *fakeWatchStream) dispatch(event *mvccpb.Event) {
+	for id, create := range w.watches {
+		w.send(id, create, event)
+	}
+}
+
+func (w *fakeWatchStream) send(id int64, create *pb.WatchCreateRequest, event *mvccpb.Event) {
+	if !inRange(event.Kv.Key, create.Key, create.RangeEnd) {
+		return
+	}
+	for _, filter := range create.Filters {
+		if (filter == pb.WatchCreateRequest_NOPUT && event.Type == mvccpb.PUT) ||
+			(filter == pb.WatchCreateRequest_NODELETE && event.Type == mvccpb.DELETE) {
+			return
+		}
+	}
+
+	w.queue.push(&pb.WatchResponse{
+		Header:  &pb.ResponseHeader{ClusterId: 1, MemberId: 1, RaftTerm: 1, Revision: event.Kv.ModRevision},
+		WatchId: id,
+		Events:  []*mvccpb.Event{event},
+	})
+}
+
+func (w *fakeWatchStream) Recv() (*pb.WatchResponse, error) {
+	res, err := w.queue.pop(w.ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*pb.WatchResponse), nil
+}
+
+func (w *fakeWatchStream) Context() context.Context {
+	return w.ctx
+}
+
+func (w *fakeWatchStream) CloseSend() error {
+	return nil
+}
+
+// fakeQueue is an unbounded queue of stream responses, so the server never waits for a client
+type fakeQueue struct {
+	mx     sync.Mutex
+	items  []interface{}
+	notify chan struct{}
+}
+
+func newFakeQueue() *fakeQueue {
+	return &fakeQueue{notify: make(chan struct{}, 1)}
+}
+
+func (q *fakeQueue) push(item interface{}) {
+	q.mx.Lock()
+	q.items = append(q.items, item)
+	q.mx.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *fakeQueue) pop(ctx context.Context) (interface{}, error) {
+	for {
+		q.mx.Lock()
+		if len(q.items) != 0 {
+			item := q.items[0]
+			q.items = q.items[1:]
+			q.mx.Unlock()
+			return item, nil
+		}
+		q.mx.Unlock()
+
+		select {
+		case <-q.notify:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
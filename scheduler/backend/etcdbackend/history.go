@@ -0,0 +1,84 @@
+package etcdbackend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	etcd "go.etcd.io/etcd/client/v3"
+
+	"github.com/skvoch/reter/scheduler/models"
+)
+
+// AddExecution puts the execution under the history prefix of the task, the keys are ordered by the start time,
+// so the records beyond the retention are deleted with key ranges
+func (b *Backend) AddExecution(ctx context.Context, taskName string, execution models.Execution, retention models.Retention) error {
+	data, err := json.Marshal(execution)
+	if err != nil {
+		return fmt.Errorf("failed to marshal execution: %w", err)
+	}
+
+	prefix := b.historyPrefix(taskName)
+	if _, err := b.client.Put(ctx, prefix+historyID(execution.Start)+"-"+execution.NodeID, string(data)); err != nil {
+		return fmt.Errorf("failed to put execution: %w", err)
+	}
+
+	if retention.MaxAge > 0 {
+		cutoff := prefix + historyID(execution.Start.Add(-retention.MaxAge))
+		if _, err := b.client.Delete(ctx, prefix, etcd.WithRange(cutoff)); err != nil {
+			return fmt.Errorf("failed to delete old executions: %w", err)
+		}
+	}
+
+	if retention.MaxCount > 0 {
+		res, err := b.client.Get(ctx, prefix, etcd.WithPrefix(), etcd.WithKeysOnly(),
+			etcd.WithSort(etcd.SortByKey, etcd.SortDescend), etcd.WithLimit(int64(retention.MaxCount)+1))
+		if err != nil {
+			return fmt.Errorf("failed to get executions: %w", err)
+		}
+
+		if len(res.Kvs) > retention.MaxCount {
+			// the newest record to drop and all records before it
+			last := string(res.Kvs[retention.MaxCount].Key)
+			if _, err := b.client.Delete(ctx, prefix, etcd.WithRange(last+"\x00")); err != nil {
+				return fmt.Errorf("failed to delete old executions: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (b *Backend) History(ctx context.Context, taskName string, limit int) ([]models.Execution, error) {
+	opts := []etcd.OpOption{etcd.WithPrefix(), etcd.WithSort(etcd.SortByKey, etcd.SortDescend)}
+	if limit > 0 {
+		opts = append(opts, etcd.WithLimit(int64(limit)))
+	}
+
+	res, err := b.client.Get(ctx, b.historyPrefix(taskName), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]models.Execution, 0, len(res.Kvs))
+	for _, kv := range res.Kvs {
+		var execution models.Execution
+		if err := json.Unmarshal(kv.Value, &execution); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal execution: %w", err)
+		}
+		out = append(out, execution)
+	}
+	return out, nil
+}
+
+func (b *Backend) historyPrefix(taskName string) string {
+	if b.prefix == "" {
+		return taskName + "/history/"
+	}
+	return b.prefix + "/tasks/" + taskName + "/history/"
+}
+
+// historyID formats the time as a fixed width number, so the keys sort in time order
+func historyID(t time.Time) string {
+	return fmt.Sprintf("%020d", t.UnixNano())
+}
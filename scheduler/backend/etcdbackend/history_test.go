@@ -0,0 +1,48 @@
+package etcdbackend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skvoch/reter/scheduler/models"
+)
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+	b := makeBackend(t)
+
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	for n := 0; n < 5; n++ {
+		execution := models.Execution{
+			Start:   start.Add(time.Duration(n) * time.Minute),
+			NodeID:  "node",
+			Outcome: models.OutcomeSucceeded,
+		}
+		assert.NoError(t, b.AddExecution(ctx, "task", execution, models.Retention{MaxCount: 3}))
+	}
+
+	history, err := b.History(ctx, "task", 0)
+	assert.NoError(t, err)
+	assert.Len(t, history, 3)
+	for idx, execution := range history {
+		assert.True(t, start.Add(time.Duration(4-idx)*time.Minute).Equal(execution.Start))
+	}
+
+	history, err = b.History(ctx, "task", 1)
+	assert.NoError(t, err)
+	assert.Len(t, history, 1)
+	assert.True(t, start.Add(time.Minute*4).Equal(history[0].Start))
+
+	// the executions older than the max age are dropped
+	execution := models.Execution{Start: start.Add(time.Minute * 10), NodeID: "node", Outcome: models.OutcomeFailed}
+	assert.NoError(t, b.AddExecution(ctx, "task", execution, models.Retention{MaxAge: time.Minute*6 + time.Second*30}))
+
+	history, err = b.History(ctx, "task", 0)
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, models.OutcomeFailed, history[0].Outcome)
+	assert.True(t, start.Add(time.Minute*4).Equal(history[1].Start))
+}
@@ -0,0 +1,60 @@
+package etcdbackend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	etcd "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/skvoch/reter/scheduler/backend"
+)
+
+// lock is an etcd mutex backed by a lease, the lease is kept alive until the lock is released
+type lock struct {
+	session *concurrency.Session
+	mutex   *concurrency.Mutex
+}
+
+func newLock(ctx context.Context, client *etcd.Client, key string, ttl int) (*lock, error) {
+	session, err := concurrency.NewSession(client, concurrency.WithTTL(ttl))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lease: %w", err)
+	}
+
+	mutex := concurrency.NewMutex(session, key)
+	if err := mutex.TryLock(ctx); err != nil {
+		_ = session.Close()
+
+		if errors.Is(err, concurrency.ErrLocked) {
+			return nil, backend.ErrAlreadyLocked
+		}
+		return nil, err
+	}
+
+	return &lock{
+		session: session,
+		mutex:   mutex,
+	}, nil
+}
+
+func (l *lock) Lost() <-chan struct{} {
+	return l.session.Done()
+}
+
+func (l *lock) Release(ctx context.Context) error {
+	select {
+	case <-l.session.Done():
+		// the lock key has been removed together with the lease
+		return nil
+	default:
+	}
+
+	// the session is closed even if unlocking has failed, so the lease does not outlive the lock
+	err := l.mutex.Unlock(ctx)
+	if closeErr := l.session.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,95 @@
+package etcdbackend
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	etcd "go.etcd.io/etcd/client/v3"
+
+	"github.com/skvoch/reter/scheduler/backend"
+)
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	b := makeBackend(t)
+
+	l, err := b.Acquire(ctx, "task", time.Minute)
+	assert.NoError(t, err)
+
+	holder, err := b.LockHolder(ctx, "task")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, holder)
+
+	_, err = b.Acquire(ctx, "task", time.Minute)
+	assert.ErrorIs(t, err, backend.ErrAlreadyLocked)
+
+	// other tasks are not blocked
+	other, err := b.Acquire(ctx, "other", time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, other.Release(ctx))
+
+	assert.NoError(t, l.Release(ctx))
+
+	holder, err = b.LockHolder(ctx, "task")
+	assert.NoError(t, err)
+	assert.Empty(t, holder)
+
+	l, err = b.Acquire(ctx, "task", time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Release(ctx))
+}
+
+func TestLockLost(t *testing.T) {
+	ctx := context.Background()
+	b := makeBackend(t)
+
+	// a short ttl makes the session notice the revoked lease with its next keep-alive
+	l, err := b.Acquire(ctx, "task", time.Second*2)
+	assert.NoError(t, err)
+
+	holder, err := b.LockHolder(ctx, "task")
+	assert.NoError(t, err)
+	lease, err := strconv.ParseInt(holder, 16, 64)
+	assert.NoError(t, err)
+
+	// the lease is revoked, as it happens when it has not been kept alive
+	_, err = b.client.Revoke(ctx, etcd.LeaseID(lease))
+	assert.NoError(t, err)
+
+	select {
+	case <-l.Lost():
+	case <-time.After(time.Second * 5):
+		t.Fatal("lock has not been lost after its lease was revoked")
+	}
+	assert.NoError(t, l.Release(ctx))
+
+	l, err = b.Acquire(ctx, "task", time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Release(ctx))
+}
+
+func TestLockReleaseFailure(t *testing.T) {
+	ctx := context.Background()
+	b := makeBackend(t)
+
+	l, err := b.Acquire(ctx, "task", time.Minute)
+	assert.NoError(t, err)
+
+	// unlocking fails with the cancelled context, the lease is revoked anyway
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Error(t, l.Release(cancelled))
+
+	select {
+	case <-l.Lost():
+	case <-time.After(time.Second * 5):
+		t.Fatal("lease has not been revoked")
+	}
+
+	l, err = b.Acquire(ctx, "task", time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Release(ctx))
+}
@@ -0,0 +1,96 @@
+package etcdbackend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	etcd "go.etcd.io/etcd/client/v3"
+
+	"github.com/skvoch/reter/scheduler/models"
+)
+
+func (b *Backend) GetState(ctx context.Context, taskName string) (*models.State, error) {
+	state, revision, err := b.getState(ctx, taskName)
+	if err != nil {
+		return nil, err
+	}
+	if revision == 0 {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+// UpdateState reads the record and puts the updated one in a transaction comparing the key mod revision,
+// the update is applied again to the new record if another node has changed it in between
+func (b *Backend) UpdateState(ctx context.Context, taskName string, update func(state models.State) models.State) error {
+	for {
+		state, revision, err := b.getState(ctx, taskName)
+		if err != nil {
+			return err
+		}
+
+		ok, err := b.putState(ctx, taskName, update(state), revision)
+		if err != nil {
+			return fmt.Errorf("failed to update state: %w", err)
+		}
+		if ok {
+			return nil
+		}
+	}
+}
+
+// getState returns the record with the mod revision of its key, the mod revision of a missing key is 0
+func (b *Backend) getState(ctx context.Context, taskName string) (models.State, int64, error) {
+	res, err := b.client.Get(ctx, b.lastActionKey(taskName))
+	if err != nil {
+		return models.State{}, 0, err
+	}
+	if len(res.Kvs) == 0 {
+		return models.State{}, 0, nil
+	}
+
+	state, err := parseState(res.Kvs[0].Value)
+	if err != nil {
+		return models.State{}, 0, err
+	}
+	return state, res.Kvs[0].ModRevision, nil
+}
+
+// putState puts the record unless the key has been changed since the given revision
+func (b *Backend) putState(ctx context.Context, taskName string, state models.State, revision int64) (bool, error) {
+	state.Version = models.StateVersion
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	txn, err := b.client.Txn(ctx).
+		If(etcd.Compare(etcd.ModRevision(b.lastActionKey(taskName)), "=", revision)).
+		Then(etcd.OpPut(b.lastActionKey(taskName), string(data))).
+		Commit()
+	if err != nil {
+		return false, err
+	}
+	return txn.Succeeded, nil
+}
+
+// parseState parses the JSON record, older versions store the bare last action time in RFC3339 format
+func parseState(value []byte) (models.State, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(value), []byte("{")) {
+		var out models.State
+		if err := json.Unmarshal(value, &out); err != nil {
+			return models.State{}, fmt.Errorf("failed to parse state: %w", err)
+		}
+		return out, nil
+	}
+
+	last, err := time.Parse(time.RFC3339Nano, string(value))
+	if err != nil {
+		return models.State{}, fmt.Errorf("failed to parse last action time: %w", err)
+	}
+	return models.State{LastAction: &last}, nil
+}
@@ -0,0 +1,80 @@
+package etcdbackend
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skvoch/reter/scheduler/models"
+)
+
+func TestClaimLegacyTimestamp(t *testing.T) {
+	ctx := context.Background()
+	b := makeBackend(t)
+
+	previous := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	_, err := b.client.Put(ctx, b.lastActionKey("task"), previous.Format(time.RFC3339))
+	assert.NoError(t, err)
+
+	slot := previous.Add(time.Minute)
+	ok, last, err := b.Claim(ctx, "task", slot, func(lastActionTime *time.Time) bool {
+		return lastActionTime.Before(slot)
+	})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, previous.Equal(*last))
+
+	// the timestamp is replaced by the record
+	state, err := b.GetState(ctx, "task")
+	assert.NoError(t, err)
+	assert.Equal(t, models.StateVersion, state.Version)
+	assert.True(t, slot.Equal(*state.LastAction))
+}
+
+func TestUpdateState(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		b     = makeBackend(t)
+		last  = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+		calls int32
+		read  sync.WaitGroup
+		wg    sync.WaitGroup
+	)
+
+	state, err := b.GetState(ctx, "task")
+	assert.NoError(t, err)
+	assert.Nil(t, state)
+
+	assert.NoError(t, b.SetLastActionTime(ctx, "task", last))
+
+	// concurrent updates are applied again on conflicts, so none of them is lost
+	read.Add(10)
+	for n := 0; n < 10; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := b.UpdateState(ctx, "task", func(state models.State) models.State {
+				// the first updates of all nodes start from the same record
+				if atomic.AddInt32(&calls, 1) <= 10 {
+					read.Done()
+					read.Wait()
+				}
+				state.ConsecutiveFailures++
+				return state
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	state, err = b.GetState(ctx, "task")
+	assert.NoError(t, err)
+	assert.Equal(t, models.StateVersion, state.Version)
+	assert.Equal(t, 10, state.ConsecutiveFailures)
+	assert.True(t, last.Equal(*state.LastAction))
+}
@@ -0,0 +1,558 @@
+// Package memorybackend provides an in-process backend for tests and single-process deployments.
+// Schedulers sharing one Backend behave like nodes sharing one etcd cluster.
+package memorybackend
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/skvoch/reter/scheduler/backend"
+	"github.com/skvoch/reter/scheduler/models"
+)
+
+type Backend struct {
+	mx       sync.Mutex
+	locks    map[string]*lock
+	lockSeq  int
+	last     map[string]time.Time
+	failures map[string]models.Failure
+	history  map[string][]models.Execution
+	// states keeps the state records without the last action time, which is kept in last
+	states map[string]models.State
+	paused map[string]bool
+	// triggers are the triggers made while no node was running the task
+	triggers map[string]bool
+
+	controlHandlers    []backend.ControlHandler
+	definitions        map[string][]byte
+	definitionHandlers []backend.DefinitionHandler
+}
+
+func New() *Backend {
+	return &Backend{
+		locks:    make(map[string]*lock),
+		last:     make(map[string]time.Time),
+		failures: make(map[string]models.Failure),
+		history:  make(map[string][]models.Execution),
+		states:   make(map[string]models.State),
+		paused:   make(map[string]bool),
+		triggers: make(map[string]bool),
+
+		definitions: make(map[string][]byte),
+	}
+}
+
+// Acquire takes the task lock. Like an etcd lease, the lock expires after ttl unless its holder refreshes it,
+// it is refreshed in the background until it is released. StopKeepAlive and Expire simulate a holder that has died.
+func (b *Backend) Acquire(ctx context.Context, taskName string, ttl time.Duration) (backend.Lock, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if _, ok := b.locks[taskName]; ok {
+		return nil, backend.ErrAlreadyLocked
+	}
+
+	b.lockSeq++
+	l := &lock{
+		backend:  b,
+		taskName: taskName,
+		id:       strconv.Itoa(b.lockSeq),
+		ttl:      ttl,
+		lost:     make(chan struct{}),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	b.locks[taskName] = l
+
+	if ttl > 0 {
+		l.timer = time.AfterFunc(ttl, func() {
+			b.mx.Lock()
+			defer b.mx.Unlock()
+
+			b.expire(l)
+		})
+		go l.keepAlive()
+	} else {
+		close(l.done)
+	}
+	return l, nil
+}
+
+// Expire drops the task lock as if its lease has not been kept alive, the holder observes it via Lock.Lost
+func (b *Backend) Expire(taskName string) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if l, ok := b.locks[taskName]; ok {
+		b.expire(l)
+	}
+}
+
+// StopKeepAlive stops refreshing the task lock as if its holder has hung, the lock expires after its ttl
+func (b *Backend) StopKeepAlive(taskName string) {
+	b.mx.Lock()
+	l, ok := b.locks[taskName]
+	b.mx.Unlock()
+
+	if ok {
+		l.stopKeepAlive()
+	}
+}
+
+// expire drops the lock if it is still held, b.mx has to be held
+func (b *Backend) expire(l *lock) {
+	if l.expired {
+		return
+	}
+	l.expired = true
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+
+	if b.locks[l.taskName] == l {
+		delete(b.locks, l.taskName)
+	}
+	close(l.lost)
+}
+
+// IsLocked reports whether the task lock is held by any node
+func (b *Backend) IsLocked(taskName string) bool {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	_, ok := b.locks[taskName]
+	return ok
+}
+
+// LockHolder returns the sequence number of the held lock acquisition
+func (b *Backend) LockHolder(ctx context.Context, taskName string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	l, ok := b.locks[taskName]
+	if !ok {
+		return "", nil
+	}
+	return l.id, nil
+}
+
+func (b *Backend) GetLastActionTime(ctx context.Context, taskName string) (*time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	out, ok := b.last[taskName]
+	if !ok {
+		return nil, nil
+	}
+	return &out, nil
+}
+
+func (b *Backend) SetLastActionTime(ctx context.Context, taskName string, t time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.last[taskName] = t
+	return nil
+}
+
+func (b *Backend) Claim(ctx context.Context, taskName string, t time.Time, isDue func(lastActionTime *time.Time) bool) (bool, *time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return false, nil, err
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	var previous *time.Time
+	if last, ok := b.last[taskName]; ok {
+		previous = &last
+	}
+
+	if !isDue(previous) {
+		return false, previous, nil
+	}
+
+	b.last[taskName] = t
+	return true, previous, nil
+}
+
+func (b *Backend) Unclaim(ctx context.Context, taskName string, claimed time.Time, previous *time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if last, ok := b.last[taskName]; !ok || !last.Equal(claimed) {
+		return nil
+	}
+
+	if previous == nil {
+		delete(b.last, taskName)
+	} else {
+		b.last[taskName] = *previous
+	}
+	return nil
+}
+
+func (b *Backend) SetLastFailure(ctx context.Context, taskName string, failure models.Failure) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.failures[taskName] = failure
+	return nil
+}
+
+// Now returns the local time, all nodes of the memory backend share the clock of the process
+func (b *Backend) Now(ctx context.Context) (time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, err
+	}
+	return time.Now(), nil
+}
+
+func (b *Backend) GetState(ctx context.Context, taskName string) (*models.State, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	state, ok := b.state(taskName)
+	if !ok {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+func (b *Backend) UpdateState(ctx context.Context, taskName string, update func(state models.State) models.State) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	state, _ := b.state(taskName)
+	state = update(state)
+	state.Version = models.StateVersion
+
+	if state.LastAction != nil {
+		b.last[taskName] = *state.LastAction
+	} else {
+		delete(b.last, taskName)
+	}
+	state.LastAction = nil
+	b.states[taskName] = state
+	return nil
+}
+
+// state joins the stored record with the last action time, b.mx has to be held
+func (b *Backend) state(taskName string) (models.State, bool) {
+	state, hasState := b.states[taskName]
+	last, hasLast := b.last[taskName]
+	if hasLast {
+		state.LastAction = &last
+	}
+	return state, hasState || hasLast
+}
+
+// AddExecution appends the execution to the history of the task, the executions are expected in time order
+func (b *Backend) AddExecution(ctx context.Context, taskName string, execution models.Execution, retention models.Retention) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	history := append(b.history[taskName], execution)
+
+	if retention.MaxAge > 0 {
+		cutoff := execution.Start.Add(-retention.MaxAge)
+		for len(history) != 0 && history[0].Start.Before(cutoff) {
+			history = history[1:]
+		}
+	}
+	if retention.MaxCount > 0 && len(history) > retention.MaxCount {
+		history = history[len(history)-retention.MaxCount:]
+	}
+
+	b.history[taskName] = history
+	return nil
+}
+
+func (b *Backend) History(ctx context.Context, taskName string, limit int) ([]models.Execution, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	history := b.history[taskName]
+	if limit <= 0 || limit > len(history) {
+		limit = len(history)
+	}
+
+	out := make([]models.Execution, 0, limit)
+	for idx := len(history) - 1; idx >= len(history)-limit; idx-- {
+		out = append(out, history[idx])
+	}
+	return out, nil
+}
+
+// WatchControl passes the paused state and triggers set with SetPaused and Trigger to the handler until ctx is done,
+// the kept triggers of the tasks the handler has are passed to it as well
+func (b *Backend) WatchControl(ctx context.Context, handler backend.ControlHandler) error {
+	b.mx.Lock()
+	b.controlHandlers = append(b.controlHandlers, handler)
+	paused := make([]string, 0, len(b.paused))
+	for taskName := range b.paused {
+		paused = append(paused, taskName)
+	}
+	var triggers []string
+	for taskName := range b.triggers {
+		if handler.HasTask(taskName) {
+			delete(b.triggers, taskName)
+			triggers = append(triggers, taskName)
+		}
+	}
+	b.mx.Unlock()
+
+	for _, taskName := range paused {
+		handler.SetPaused(taskName, true)
+	}
+	for _, taskName := range triggers {
+		handler.Trigger(taskName)
+	}
+
+	<-ctx.Done()
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	for idx, h := range b.controlHandlers {
+		if h == handler {
+			b.controlHandlers = append(b.controlHandlers[:idx], b.controlHandlers[idx+1:]...)
+			break
+		}
+	}
+	return ctx.Err()
+}
+
+// SetPaused pauses or resumes the task on all nodes
+func (b *Backend) SetPaused(taskName string, paused bool) {
+	b.mx.Lock()
+	if paused {
+		b.paused[taskName] = true
+	} else {
+		delete(b.paused, taskName)
+	}
+	handlers := append([]backend.ControlHandler(nil), b.controlHandlers...)
+	b.mx.Unlock()
+
+	for _, handler := range handlers {
+		handler.SetPaused(taskName, paused)
+	}
+}
+
+// Trigger runs the task on the first node which has it. If there is no such node false is returned
+// and the trigger is kept until a node starts the task.
+func (b *Backend) Trigger(taskName string) bool {
+	b.mx.Lock()
+	handlers := append([]backend.ControlHandler(nil), b.controlHandlers...)
+	b.mx.Unlock()
+
+	for _, handler := range handlers {
+		if handler.HasTask(taskName) {
+			handler.Trigger(taskName)
+			return true
+		}
+	}
+
+	b.mx.Lock()
+	b.triggers[taskName] = true
+	b.mx.Unlock()
+	return false
+}
+
+// ClaimTrigger takes the trigger kept by Trigger, true is returned only to the first caller
+func (b *Backend) ClaimTrigger(ctx context.Context, taskName string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if !b.triggers[taskName] {
+		return false, nil
+	}
+	delete(b.triggers, taskName)
+	return true, nil
+}
+
+// WatchDefinitions passes the definitions put with PutDefinition to the handler until ctx is done
+func (b *Backend) WatchDefinitions(ctx context.Context, handler backend.DefinitionHandler) error {
+	b.mx.Lock()
+	b.definitionHandlers = append(b.definitionHandlers, handler)
+	definitions := make(map[string][]byte, len(b.definitions))
+	for name, spec := range b.definitions {
+		definitions[name] = spec
+	}
+	b.mx.Unlock()
+
+	for name, spec := range definitions {
+		handler.PutDefinition(name, spec)
+	}
+
+	<-ctx.Done()
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	for idx, h := range b.definitionHandlers {
+		if h == handler {
+			b.definitionHandlers = append(b.definitionHandlers[:idx], b.definitionHandlers[idx+1:]...)
+			break
+		}
+	}
+	return ctx.Err()
+}
+
+// PutDefinition stores the definition and passes it to all watching nodes
+func (b *Backend) PutDefinition(definition models.Definition) {
+	// a definition consists of strings only, so it is always marshalled
+	spec, _ := json.Marshal(definition)
+
+	b.mx.Lock()
+	b.definitions[definition.Name] = spec
+	handlers := append([]backend.DefinitionHandler(nil), b.definitionHandlers...)
+	b.mx.Unlock()
+
+	for _, handler := range handlers {
+		handler.PutDefinition(definition.Name, spec)
+	}
+}
+
+func (b *Backend) DeleteDefinition(name string) {
+	b.mx.Lock()
+	delete(b.definitions, name)
+	handlers := append([]backend.DefinitionHandler(nil), b.definitionHandlers...)
+	b.mx.Unlock()
+
+	for _, handler := range handlers {
+		handler.DeleteDefinition(name)
+	}
+}
+
+// LastFailure returns the last recorded failure of the task
+func (b *Backend) LastFailure(taskName string) (models.Failure, bool) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	out, ok := b.failures[taskName]
+	return out, ok
+}
+
+type lock struct {
+	backend  *Backend
+	taskName string
+	// id tells the holders apart, it is the sequence number of the acquisition
+	id   string
+	ttl  time.Duration
+	lost chan struct{}
+
+	// timer expires the lock unless keepAlive resets it, timer and expired are guarded by backend.mx
+	timer   *time.Timer
+	expired bool
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func (l *lock) keepAlive() {
+	defer close(l.done)
+
+	interval := l.ttl / 3
+	if interval <= 0 {
+		interval = l.ttl
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+
+		case <-ticker.C:
+			l.backend.mx.Lock()
+			expired := l.expired
+			if !expired {
+				l.timer.Reset(l.ttl)
+			}
+			l.backend.mx.Unlock()
+
+			if expired {
+				return
+			}
+		}
+	}
+}
+
+func (l *lock) stopKeepAlive() {
+	l.stopOnce.Do(func() {
+		close(l.stop)
+	})
+	<-l.done
+}
+
+func (l *lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *lock) Release(ctx context.Context) error {
+	l.stopKeepAlive()
+
+	l.backend.mx.Lock()
+	defer l.backend.mx.Unlock()
+
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+	l.expired = true
+
+	// an expired lock may be held by another node already
+	if l.backend.locks[l.taskName] == l {
+		delete(l.backend.locks, l.taskName)
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package memorybackend
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/skvoch/reter/scheduler/backend"
+	"github.com/skvoch/reter/scheduler/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	b := New()
+
+	l, err := b.Acquire(ctx, "task", time.Second)
+	assert.NoError(t, err)
+	assert.True(t, b.IsLocked("task"))
+
+	holder, err := b.LockHolder(ctx, "task")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, holder)
+
+	_, err = b.Acquire(ctx, "task", time.Second)
+	assert.ErrorIs(t, err, backend.ErrAlreadyLocked)
+
+	other, err := b.Acquire(ctx, "other", time.Second)
+	assert.NoError(t, err)
+	assert.NoError(t, other.Release(ctx))
+
+	assert.NoError(t, l.Release(ctx))
+	assert.False(t, b.IsLocked("task"))
+
+	holder, err = b.LockHolder(ctx, "task")
+	assert.NoError(t, err)
+	assert.Empty(t, holder)
+
+	_, err = b.Acquire(ctx, "task", time.Second)
+	assert.NoError(t, err)
+}
+
+func TestExpire(t *testing.T) {
+	ctx := context.Background()
+	b := New()
+
+	l, err := b.Acquire(ctx, "task", time.Second)
+	assert.NoError(t, err)
+
+	b.Expire("task")
+
+	select {
+	case <-l.Lost():
+	default:
+		t.Fatal("lock is not lost after expiration")
+	}
+
+	next, err := b.Acquire(ctx, "task", time.Second)
+	assert.NoError(t, err)
+
+	// releasing the expired lock does not affect the new holder
+	assert.NoError(t, l.Release(ctx))
+	assert.True(t, b.IsLocked("task"))
+	assert.NoError(t, next.Release(ctx))
+}
+
+func TestLockTTL(t *testing.T) {
+	ctx := context.Background()
+	b := New()
+
+	l, err := b.Acquire(ctx, "task", time.Millisecond*30)
+	assert.NoError(t, err)
+
+	// the lock is kept alive while it is held, so it outlives its ttl
+	time.Sleep(time.Millisecond * 100)
+
+	select {
+	case <-l.Lost():
+		t.Fatal("lock is lost while it is kept alive")
+	default:
+	}
+
+	_, err = b.Acquire(ctx, "task", time.Millisecond*30)
+	assert.ErrorIs(t, err, backend.ErrAlreadyLocked)
+
+	// the lock expires once it is not refreshed anymore
+	b.StopKeepAlive("task")
+
+	select {
+	case <-l.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lock is not lost after its ttl")
+	}
+	assert.False(t, b.IsLocked("task"))
+
+	next, err := b.Acquire(ctx, "task", time.Millisecond*30)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Release(ctx))
+	assert.True(t, b.IsLocked("task"))
+	assert.NoError(t, next.Release(ctx))
+}
+
+func TestConcurrentAcquire(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		b        = New()
+		acquired int32
+		wg       sync.WaitGroup
+	)
+
+	for n := 0; n < 50; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := b.Acquire(ctx, "task", time.Second); err == nil {
+				atomic.AddInt32(&acquired, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), acquired)
+}
+
+func TestState(t *testing.T) {
+	ctx := context.Background()
+	b := New()
+
+	last, err := b.GetLastActionTime(ctx, "task")
+	assert.NoError(t, err)
+	assert.Nil(t, last)
+
+	now := time.Now()
+	assert.NoError(t, b.SetLastActionTime(ctx, "task", now))
+
+	last, err = b.GetLastActionTime(ctx, "task")
+	assert.NoError(t, err)
+	assert.Equal(t, now, *last)
+
+	failure := models.Failure{Time: now, Outcome: models.OutcomeFailed, Error: "error"}
+	assert.NoError(t, b.SetLastFailure(ctx, "task", failure))
+
+	out, ok := b.LastFailure("task")
+	assert.True(t, ok)
+	assert.Equal(t, failure, out)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = b.GetLastActionTime(cancelled, "task")
+	assert.Error(t, err)
+}
+
+func TestClaim(t *testing.T) {
+	ctx := context.Background()
+	b := New()
+
+	always := func(*time.Time) bool { return true }
+	never := func(*time.Time) bool { return false }
+
+	first := time.Now()
+	claimed, previous, err := b.Claim(ctx, "task", first, always)
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+	assert.Nil(t, previous)
+
+	claimed, previous, err = b.Claim(ctx, "task", first.Add(time.Second), never)
+	assert.NoError(t, err)
+	assert.False(t, claimed)
+	assert.Equal(t, first, *previous)
+
+	second := first.Add(time.Minute)
+	claimed, previous, err = b.Claim(ctx, "task", second, always)
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+	assert.Equal(t, first, *previous)
+
+	// the claim replaced by another node is kept
+	assert.NoError(t, b.Unclaim(ctx, "task", first, nil))
+	last, err := b.GetLastActionTime(ctx, "task")
+	assert.NoError(t, err)
+	assert.Equal(t, second, *last)
+
+	assert.NoError(t, b.Unclaim(ctx, "task", second, previous))
+	last, err = b.GetLastActionTime(ctx, "task")
+	assert.NoError(t, err)
+	assert.Equal(t, first, *last)
+}
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2021, 6, 1, 3, 0, 0, 0, time.UTC)
+
+	execution := func(hours int) models.Execution {
+		return models.Execution{Start: start.Add(time.Hour * time.Duration(hours)), NodeID: "node", Outcome: models.OutcomeSucceeded}
+	}
+
+	cases := []struct {
+		Name      string
+		Retention models.Retention
+		Limit     int
+		Expected  []models.Execution
+	}{
+		{
+			Name:     "#1 without retention",
+			Expected: []models.Execution{execution(4), execution(3), execution(2), execution(1), execution(0)},
+		},
+		{
+			Name:     "#2 limit",
+			Limit:    2,
+			Expected: []models.Execution{execution(4), execution(3)},
+		},
+		{
+			Name:      "#3 max count",
+			Retention: models.Retention{MaxCount: 3},
+			Expected:  []models.Execution{execution(4), execution(3), execution(2)},
+		},
+		{
+			Name:      "#4 max age",
+			Retention: models.Retention{MaxAge: time.Hour},
+			Expected:  []models.Execution{execution(4), execution(3)},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			b := New()
+			for hours := 0; hours < 5; hours++ {
+				assert.NoError(t, b.AddExecution(ctx, "task", execution(hours), c.Retention))
+			}
+
+			history, err := b.History(ctx, "task", c.Limit)
+			assert.NoError(t, err)
+			assert.Equal(t, c.Expected, history)
+		})
+	}
+}
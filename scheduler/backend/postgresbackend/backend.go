@@ -0,0 +1,161 @@
+// Package postgresbackend provides a backend which keeps task locks and execution state in PostgreSQL.
+package postgresbackend
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/skvoch/reter/scheduler/backend"
+	"github.com/skvoch/reter/scheduler/models"
+)
+
+const (
+	defaultTableName = "reter_tasks"
+	defaultLockTTL   = time.Minute
+)
+
+type Backend struct {
+	db    *sql.DB
+	table string
+}
+
+// New creates a backend on top of the given database, the state is kept in the "reter_tasks" table
+// unless another table name is passed. The table is created by Migrate.
+func New(db *sql.DB, tableName ...string) *Backend {
+	table := defaultTableName
+	if len(tableName) != 0 {
+		table = tableName[0]
+	}
+
+	return &Backend{
+		db:    db,
+		table: table,
+	}
+}
+
+// Schema returns the statements creating the state table, it can be used with external migration tools
+func (b *Backend) Schema() string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	name TEXT PRIMARY KEY,
+	last_action_time TIMESTAMPTZ,
+	last_failure JSONB,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`, pq.QuoteIdentifier(b.table))
+}
+
+// Migrate creates the state table if it does not exist
+func (b *Backend) Migrate(ctx context.Context) error {
+	if _, err := b.db.ExecContext(ctx, b.Schema()); err != nil {
+		return fmt.Errorf("failed to create %s table: %w", b.table, err)
+	}
+	return nil
+}
+
+// Acquire takes a session level advisory lock on a dedicated connection,
+// the lock is held until it is released or the connection is closed
+func (b *Backend) Acquire(ctx context.Context, taskName string, ttl time.Duration) (backend.Lock, error) {
+	if ttl <= 0 {
+		ttl = defaultLockTTL
+	}
+
+	conn, err := b.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	var ok bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", b.lockID(taskName)).Scan(&ok); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if !ok {
+		_ = conn.Close()
+		return nil, backend.ErrAlreadyLocked
+	}
+
+	return newLock(conn, b.lockID(taskName), ttl), nil
+}
+
+// LockHolder returns the process id of the database session holding the lock
+func (b *Backend) LockHolder(ctx context.Context, taskName string) (string, error) {
+	var pid int64
+
+	err := b.db.QueryRowContext(ctx, `SELECT pid FROM pg_locks
+WHERE locktype = 'advisory' AND granted AND objsubid = 1 AND (classid::bigint << 32 | objid::bigint) = $1`, b.lockID(taskName)).Scan(&pid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(pid, 10), nil
+}
+
+func (b *Backend) GetLastActionTime(ctx context.Context, taskName string) (*time.Time, error) {
+	var out sql.NullTime
+
+	query := fmt.Sprintf("SELECT last_action_time FROM %s WHERE name = $1", pq.QuoteIdentifier(b.table))
+	err := b.db.QueryRowContext(ctx, query, taskName).Scan(&out)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !out.Valid {
+		return nil, nil
+	}
+	return &out.Time, nil
+}
+
+func (b *Backend) SetLastActionTime(ctx context.Context, taskName string, t time.Time) error {
+	query := fmt.Sprintf(`INSERT INTO %s (name, last_action_time) VALUES ($1, $2)
+ON CONFLICT (name) DO UPDATE SET last_action_time = EXCLUDED.last_action_time, updated_at = now()`,
+		pq.QuoteIdentifier(b.table))
+
+	if _, err := b.db.ExecContext(ctx, query, taskName, t); err != nil {
+		return fmt.Errorf("failed to set last action time: %w", err)
+	}
+	return nil
+}
+
+func (b *Backend) SetLastFailure(ctx context.Context, taskName string, failure models.Failure) error {
+	data, err := json.Marshal(failure)
+	if err != nil {
+		return fmt.Errorf("failed to marshal last failure: %w", err)
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %s (name, last_failure) VALUES ($1, $2::jsonb)
+ON CONFLICT (name) DO UPDATE SET last_failure = EXCLUDED.last_failure, updated_at = now()`,
+		pq.QuoteIdentifier(b.table))
+
+	if _, err := b.db.ExecContext(ctx, query, taskName, string(data)); err != nil {
+		return fmt.Errorf("failed to set last failure: %w", err)
+	}
+	return nil
+}
+
+// Now returns the time of the database server, clock_timestamp is used since now() is fixed within a transaction
+func (b *Backend) Now(ctx context.Context) (time.Time, error) {
+	var out time.Time
+	if err := b.db.QueryRowContext(ctx, "SELECT clock_timestamp()").Scan(&out); err != nil {
+		return time.Time{}, err
+	}
+	return out, nil
+}
+
+// lockID maps the task name to the 64-bit advisory lock key,
+// the table name is hashed in too, so backends with different tables do not block each other
+func (b *Backend) lockID(taskName string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(b.table + ":" + taskName))
+	return int64(h.Sum64())
+}
@@ -0,0 +1,134 @@
+package postgresbackend
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skvoch/reter/scheduler/backend"
+	"github.com/skvoch/reter/scheduler/models"
+)
+
+const testTableName = "reter_tasks_test"
+
+// openDB connects to the database from RETER_POSTGRES_DSN, tests are skipped if it is not set
+func openDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("RETER_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("RETER_POSTGRES_DSN is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, _ = db.Exec("DROP TABLE IF EXISTS " + testTableName)
+		_ = db.Close()
+	})
+	return db
+}
+
+func makeBackend(t *testing.T) *Backend {
+	b := New(openDB(t), testTableName)
+	if err := b.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestMigrate(t *testing.T) {
+	b := makeBackend(t)
+
+	// the migration can be applied more than once
+	assert.NoError(t, b.Migrate(context.Background()))
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	b := makeBackend(t)
+
+	l, err := b.Acquire(ctx, "task", time.Minute)
+	assert.NoError(t, err)
+
+	holder, err := b.LockHolder(ctx, "task")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, holder)
+
+	_, err = b.Acquire(ctx, "task", time.Minute)
+	assert.ErrorIs(t, err, backend.ErrAlreadyLocked)
+
+	// other tasks are not blocked
+	other, err := b.Acquire(ctx, "other", time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, other.Release(ctx))
+
+	assert.NoError(t, l.Release(ctx))
+
+	holder, err = b.LockHolder(ctx, "task")
+	assert.NoError(t, err)
+	assert.Empty(t, holder)
+
+	l, err = b.Acquire(ctx, "task", time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Release(ctx))
+}
+
+func TestLockLost(t *testing.T) {
+	ctx := context.Background()
+	b := makeBackend(t)
+
+	l, err := b.Acquire(ctx, "task", time.Millisecond*300)
+	assert.NoError(t, err)
+
+	// the session holding the lock is killed, as it happens when the node loses its connection
+	_, err = b.db.ExecContext(ctx, `SELECT pg_terminate_backend(pid) FROM pg_locks
+WHERE locktype = 'advisory' AND objsubid = 1 AND (classid::bigint << 32 | objid::bigint) = $1`, b.lockID("task"))
+	assert.NoError(t, err)
+
+	select {
+	case <-l.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lock has not been lost after its session was terminated")
+	}
+	assert.NoError(t, l.Release(ctx))
+
+	l, err = b.Acquire(ctx, "task", time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Release(ctx))
+}
+
+func TestState(t *testing.T) {
+	ctx := context.Background()
+	b := makeBackend(t)
+
+	last, err := b.GetLastActionTime(ctx, "task")
+	assert.NoError(t, err)
+	assert.Nil(t, last)
+
+	// the failure is recorded before the task has ever succeeded
+	now := time.Date(2021, 6, 1, 12, 0, 0, 123456000, time.UTC)
+	assert.NoError(t, b.SetLastFailure(ctx, "task", models.Failure{Time: now, Outcome: models.OutcomeFailed, Error: "error"}))
+
+	last, err = b.GetLastActionTime(ctx, "task")
+	assert.NoError(t, err)
+	assert.Nil(t, last)
+
+	assert.NoError(t, b.SetLastActionTime(ctx, "task", now))
+
+	last, err = b.GetLastActionTime(ctx, "task")
+	assert.NoError(t, err)
+	assert.True(t, now.Equal(*last))
+}
+
+func TestNow(t *testing.T) {
+	b := makeBackend(t)
+
+	now, err := b.Now(context.Background())
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), now, time.Minute)
+}
@@ -0,0 +1,95 @@
+package postgresbackend
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+	"time"
+)
+
+// lock is an advisory lock bound to the session of a dedicated connection,
+// the connection is pinged until the lock is released and the lock is lost once the ping fails,
+// since the server drops the lock together with the session
+type lock struct {
+	conn *sql.Conn
+	id   int64
+	ttl  time.Duration
+
+	lost     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func newLock(conn *sql.Conn, id int64, ttl time.Duration) *lock {
+	l := &lock{
+		conn: conn,
+		id:   id,
+		ttl:  ttl,
+		lost: make(chan struct{}),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	go l.keepAlive()
+	return l
+}
+
+func (l *lock) keepAlive() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+			err := l.conn.PingContext(ctx)
+			cancel()
+
+			if err != nil {
+				close(l.lost)
+				return
+			}
+		}
+	}
+}
+
+func (l *lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *lock) Release(ctx context.Context) error {
+	l.stopOnce.Do(func() {
+		close(l.stop)
+	})
+	<-l.done
+
+	select {
+	case <-l.lost:
+		l.discard()
+		return nil
+	default:
+	}
+
+	if _, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.id); err != nil {
+		// the connection must not go back to the pool while it may still hold the lock
+		l.discard()
+		return err
+	}
+	return l.conn.Close()
+}
+
+// discard closes the underlying connection instead of returning it to the pool,
+// closing the session releases all of its advisory locks
+func (l *lock) discard() {
+	_ = l.conn.Raw(func(interface{}) error {
+		return driver.ErrBadConn
+	})
+	_ = l.conn.Close()
+}
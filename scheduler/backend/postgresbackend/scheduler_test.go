@@ -0,0 +1,51 @@
+package postgresbackend_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skvoch/reter/scheduler"
+	"github.com/skvoch/reter/scheduler/backend/postgresbackend"
+	"github.com/skvoch/reter/scheduler/internal/schedulertest"
+	"github.com/skvoch/reter/scheduler/logger/zerologadapter"
+)
+
+func TestScheduler(t *testing.T) {
+	dsn := os.Getenv("RETER_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("RETER_POSTGRES_DSN is not set")
+	}
+
+	defer func() {
+		db, err := sql.Open("postgres", dsn)
+		assert.NoError(t, err)
+		defer db.Close()
+		_, _ = db.Exec("DROP TABLE IF EXISTS reter_tasks_scheduler_test")
+	}()
+
+	// two nodes with their own connection pools to the same database
+	schedulertest.CheckIntervalTask(t, func() schedulertest.Scheduler {
+		db, err := sql.Open("postgres", dsn)
+		assert.NoError(t, err)
+		t.Cleanup(func() {
+			_ = db.Close()
+		})
+
+		b := postgresbackend.New(db, "reter_tasks_scheduler_test")
+		assert.NoError(t, b.Migrate(context.Background()))
+
+		s, err := scheduler.New(zerologadapter.NewLogger(log.Logger), &scheduler.Options{
+			Backend: b,
+			LockTTL: time.Second,
+			Timeout: time.Second,
+		})
+		assert.NoError(t, err)
+		return s
+	})
+}
@@ -0,0 +1,183 @@
+// Package redisbackend provides a backend which keeps task locks and execution state in Redis.
+package redisbackend
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/skvoch/reter/scheduler/backend"
+	"github.com/skvoch/reter/scheduler/models"
+)
+
+const (
+	defaultKeyPrefix = "reter"
+	defaultLockTTL   = time.Minute
+)
+
+type Backend struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// New creates a backend on top of the given client, keys are prefixed with "reter:"
+// unless another prefix is passed
+func New(client redis.UniversalClient, keyPrefix ...string) *Backend {
+	prefix := defaultKeyPrefix
+	if len(keyPrefix) != 0 {
+		prefix = keyPrefix[0]
+	}
+
+	return &Backend{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+// Acquire takes the lock with SET NX PX and a random token, the lock is kept alive until it is released
+func (b *Backend) Acquire(ctx context.Context, taskName string, ttl time.Duration) (backend.Lock, error) {
+	if ttl <= 0 {
+		ttl = defaultLockTTL
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate lock token: %w", err)
+	}
+
+	ok, err := b.client.SetNX(ctx, b.lockKey(taskName), token, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, backend.ErrAlreadyLocked
+	}
+
+	return newLock(b.client, b.lockKey(taskName), token, ttl), nil
+}
+
+// LockHolder returns the random token of the held lock
+func (b *Backend) LockHolder(ctx context.Context, taskName string) (string, error) {
+	token, err := b.client.Get(ctx, b.lockKey(taskName)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return token, err
+}
+
+func (b *Backend) GetLastActionTime(ctx context.Context, taskName string) (*time.Time, error) {
+	value, err := b.client.Get(ctx, b.lastActionKey(taskName)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse last action time: %w", err)
+	}
+	return &out, nil
+}
+
+func (b *Backend) SetLastActionTime(ctx context.Context, taskName string, t time.Time) error {
+	if err := b.client.Set(ctx, b.lastActionKey(taskName), t.Format(time.RFC3339Nano), 0).Err(); err != nil {
+		return fmt.Errorf("failed to set last action time: %w", err)
+	}
+	return nil
+}
+
+func (b *Backend) SetLastFailure(ctx context.Context, taskName string, failure models.Failure) error {
+	data, err := json.Marshal(failure)
+	if err != nil {
+		return fmt.Errorf("failed to marshal last failure: %w", err)
+	}
+
+	if err := b.client.Set(ctx, b.failureKey(taskName), data, 0).Err(); err != nil {
+		return fmt.Errorf("failed to set last failure: %w", err)
+	}
+	return nil
+}
+
+// AddExecution adds the execution to a sorted set scored by the start time and trims the set to the retention
+func (b *Backend) AddExecution(ctx context.Context, taskName string, execution models.Execution, retention models.Retention) error {
+	data, err := json.Marshal(execution)
+	if err != nil {
+		return fmt.Errorf("failed to marshal execution: %w", err)
+	}
+
+	key := b.historyKey(taskName)
+	pipe := b.client.TxPipeline()
+	pipe.ZAdd(ctx, key, &redis.Z{Score: float64(execution.Start.UnixNano()), Member: data})
+
+	if retention.MaxAge > 0 {
+		cutoff := execution.Start.Add(-retention.MaxAge).UnixNano()
+		pipe.ZRemRangeByScore(ctx, key, "-inf", fmt.Sprintf("(%d", cutoff))
+	}
+	if retention.MaxCount > 0 {
+		pipe.ZRemRangeByRank(ctx, key, 0, -int64(retention.MaxCount)-1)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to add execution: %w", err)
+	}
+	return nil
+}
+
+func (b *Backend) History(ctx context.Context, taskName string, limit int) ([]models.Execution, error) {
+	stop := int64(limit) - 1
+	if limit <= 0 {
+		stop = -1
+	}
+
+	values, err := b.client.ZRevRange(ctx, b.historyKey(taskName), 0, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]models.Execution, 0, len(values))
+	for _, value := range values {
+		var execution models.Execution
+		if err := json.Unmarshal([]byte(value), &execution); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal execution: %w", err)
+		}
+		out = append(out, execution)
+	}
+	return out, nil
+}
+
+// Now returns the time of the Redis server
+func (b *Backend) Now(ctx context.Context) (time.Time, error) {
+	return b.client.Time(ctx).Result()
+}
+
+func (b *Backend) lockKey(taskName string) string {
+	return b.prefix + ":locks:" + taskName
+}
+
+func (b *Backend) lastActionKey(taskName string) string {
+	return b.prefix + ":tasks:" + taskName + ":last"
+}
+
+func (b *Backend) failureKey(taskName string) string {
+	return b.prefix + ":tasks:" + taskName + ":failure"
+}
+
+func (b *Backend) historyKey(taskName string) string {
+	return b.prefix + ":tasks:" + taskName + ":history"
+}
+
+func newToken() (string, error) {
+	data := make([]byte, 16)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
@@ -0,0 +1,190 @@
+package redisbackend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skvoch/reter/scheduler/backend"
+	"github.com/skvoch/reter/scheduler/models"
+)
+
+func makeBackend(t *testing.T) (*Backend, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	return New(client), mr
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	b, mr := makeBackend(t)
+
+	l, err := b.Acquire(ctx, "task", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, mr.Exists("reter:locks:task"))
+
+	holder, err := b.LockHolder(ctx, "task")
+	assert.NoError(t, err)
+	assert.Equal(t, l.(*lock).token, holder)
+
+	_, err = b.Acquire(ctx, "task", time.Minute)
+	assert.ErrorIs(t, err, backend.ErrAlreadyLocked)
+
+	assert.NoError(t, l.Release(ctx))
+	assert.False(t, mr.Exists("reter:locks:task"))
+
+	holder, err = b.LockHolder(ctx, "task")
+	assert.NoError(t, err)
+	assert.Empty(t, holder)
+
+	l, err = b.Acquire(ctx, "task", time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Release(ctx))
+}
+
+func TestLockExpiration(t *testing.T) {
+	ctx := context.Background()
+	b, mr := makeBackend(t)
+
+	_, err := b.Acquire(ctx, "task", time.Minute)
+	assert.NoError(t, err)
+
+	mr.FastForward(time.Minute)
+
+	l, err := b.Acquire(ctx, "task", time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Release(ctx))
+}
+
+func TestReleaseChecksToken(t *testing.T) {
+	ctx := context.Background()
+	b, mr := makeBackend(t)
+
+	l, err := b.Acquire(ctx, "task", time.Minute)
+	assert.NoError(t, err)
+
+	// the lock has expired and has been taken by another node
+	assert.NoError(t, mr.Set("reter:locks:task", "another-token"))
+
+	assert.NoError(t, l.Release(ctx))
+	value, err := mr.Get("reter:locks:task")
+	assert.NoError(t, err)
+	assert.Equal(t, "another-token", value)
+}
+
+func TestKeepAlive(t *testing.T) {
+	ctx := context.Background()
+	b, mr := makeBackend(t)
+
+	l, err := b.Acquire(ctx, "task", time.Millisecond*300)
+	assert.NoError(t, err)
+
+	// the expiration is refreshed, so the lock outlives its ttl
+	time.Sleep(time.Millisecond * 500)
+	mr.FastForward(time.Millisecond * 200)
+	assert.True(t, mr.Exists("reter:locks:task"))
+
+	select {
+	case <-l.Lost():
+		t.Fatal("lock has been lost while it was kept alive")
+	default:
+	}
+
+	mr.Del("reter:locks:task")
+
+	select {
+	case <-l.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lock has not been lost after its key was deleted")
+	}
+	assert.NoError(t, l.Release(ctx))
+}
+
+func TestState(t *testing.T) {
+	ctx := context.Background()
+	b, mr := makeBackend(t)
+
+	last, err := b.GetLastActionTime(ctx, "task")
+	assert.NoError(t, err)
+	assert.Nil(t, last)
+
+	now := time.Date(2021, 6, 1, 12, 0, 0, 123456789, time.UTC)
+	assert.NoError(t, b.SetLastActionTime(ctx, "task", now))
+	assert.True(t, mr.Exists("reter:tasks:task:last"))
+
+	last, err = b.GetLastActionTime(ctx, "task")
+	assert.NoError(t, err)
+	assert.True(t, now.Equal(*last))
+
+	assert.NoError(t, b.SetLastFailure(ctx, "task", models.Failure{Time: now, Outcome: models.OutcomeFailed, Error: "error"}))
+	assert.True(t, mr.Exists("reter:tasks:task:failure"))
+}
+
+func TestKeyPrefix(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	b := New(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "billing")
+
+	assert.NoError(t, b.SetLastActionTime(ctx, "task", time.Now()))
+	assert.True(t, mr.Exists("billing:tasks:task:last"))
+}
+
+func TestNow(t *testing.T) {
+	b, mr := makeBackend(t)
+
+	serverTime := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	mr.SetTime(serverTime)
+
+	now, err := b.Now(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, serverTime.Equal(now))
+}
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+	b, _ := makeBackend(t)
+
+	start := time.Date(2021, 6, 1, 3, 0, 0, 0, time.UTC)
+	execution := func(hours int) models.Execution {
+		return models.Execution{
+			Start:    start.Add(time.Hour * time.Duration(hours)),
+			End:      start.Add(time.Hour*time.Duration(hours) + time.Second),
+			Duration: time.Second,
+			NodeID:   "node",
+			Outcome:  models.OutcomeSucceeded,
+		}
+	}
+
+	for hours := 0; hours < 5; hours++ {
+		assert.NoError(t, b.AddExecution(ctx, "task", execution(hours), models.Retention{MaxCount: 4, MaxAge: time.Hour * 2}))
+	}
+
+	history, err := b.History(ctx, "task", 0)
+	assert.NoError(t, err)
+	assert.Len(t, history, 3)
+	for idx, hours := range []int{4, 3, 2} {
+		assert.True(t, execution(hours).Start.Equal(history[idx].Start))
+		assert.Equal(t, "node", history[idx].NodeID)
+	}
+
+	history, err = b.History(ctx, "task", 1)
+	assert.NoError(t, err)
+	assert.Len(t, history, 1)
+
+	assert.NoError(t, b.AddExecution(ctx, "task", execution(5), models.Retention{MaxCount: 1}))
+	history, err = b.History(ctx, "task", 0)
+	assert.NoError(t, err)
+	assert.Len(t, history, 1)
+
+	history, err = b.History(ctx, "other", 10)
+	assert.NoError(t, err)
+	assert.Empty(t, history)
+}
@@ -0,0 +1,101 @@
+package redisbackend
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// the lock is refreshed and released only by the holder of the token
+	refreshScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+	releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+// lock is kept alive by refreshing its expiration until it is released,
+// it is lost if the key is not owned anymore or can not be refreshed within ttl
+type lock struct {
+	client redis.UniversalClient
+	key    string
+	token  string
+	ttl    time.Duration
+
+	lost     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func newLock(client redis.UniversalClient, key, token string, ttl time.Duration) *lock {
+	l := &lock{
+		client: client,
+		key:    key,
+		token:  token,
+		ttl:    ttl,
+		lost:   make(chan struct{}),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	go l.keepAlive()
+	return l
+}
+
+func (l *lock) keepAlive() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	refreshed := time.Now()
+	for {
+		select {
+		case <-l.stop:
+			return
+
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+			res, err := refreshScript.Run(ctx, l.client, []string{l.key}, l.token, l.ttl.Milliseconds()).Int()
+			cancel()
+
+			switch {
+			case err == nil && res == 1:
+				refreshed = time.Now()
+			case err == nil || time.Since(refreshed) >= l.ttl:
+				// the key is owned by another node or has expired
+				close(l.lost)
+				return
+			}
+		}
+	}
+}
+
+func (l *lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *lock) Release(ctx context.Context) error {
+	l.stopOnce.Do(func() {
+		close(l.stop)
+	})
+	<-l.done
+
+	select {
+	case <-l.lost:
+		return nil
+	default:
+	}
+
+	return releaseScript.Run(ctx, l.client, []string{l.key}, l.token).Err()
+}
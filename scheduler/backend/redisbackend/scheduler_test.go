@@ -0,0 +1,36 @@
+package redisbackend_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skvoch/reter/scheduler"
+	"github.com/skvoch/reter/scheduler/backend/redisbackend"
+	"github.com/skvoch/reter/scheduler/internal/schedulertest"
+	"github.com/skvoch/reter/scheduler/logger/zerologadapter"
+)
+
+func TestScheduler(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	// two nodes with their own clients to the same redis
+	schedulertest.CheckIntervalTask(t, func() schedulertest.Scheduler {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() {
+			_ = client.Close()
+		})
+
+		s, err := scheduler.New(zerologadapter.NewLogger(log.Logger), &scheduler.Options{
+			Backend: redisbackend.New(client),
+			LockTTL: time.Second,
+			Timeout: time.Second,
+		})
+		assert.NoError(t, err)
+		return s
+	})
+}
@@ -9,13 +9,19 @@ import (
 )
 
 var (
-	ErrEmptyTaskName      = errors.New("task name is nil")
-	ErrTaskIntervalIsZero = errors.New("task interval is zero")
-	ErrInvalidTimeFormat  = errors.New("invalid time format")
+	ErrEmptyTaskName         = errors.New("task name is nil")
+	ErrTaskIntervalIsZero    = errors.New("task interval is zero")
+	ErrInvalidTimeFormat     = errors.New("invalid time format")
+	ErrInvalidCronExpression = errors.New("invalid cron expression")
+	ErrInvalidRetryPolicy    = errors.New("invalid retry policy")
+	ErrInvalidTimeout        = errors.New("invalid timeout")
 )
 
 type Runner interface {
+	// Run runs the task and blocks until it ends
 	Run(ctx context.Context, task models.Task) error
+	// Start registers the task and runs it in the background
+	Start(ctx context.Context, task models.Task) (models.TaskHandle, error)
 }
 
 func New(runner Runner, count uint) *Builder {
@@ -28,13 +34,39 @@ func New(runner Runner, count uint) *Builder {
 type Builder struct {
 	count    uint
 	timeStr  string
+	cronExpr string
 	interval time.Duration
+	location *time.Location
+	retry    *models.RetryPolicy
+	timeout  time.Duration
 
 	tickerType models.TickerType
 
 	runner Runner
 }
 
+// In sets the location daily and cron schedules are evaluated in,
+// the scheduler default location is used if it is not set
+func (b *Builder) In(location *time.Location) *Builder {
+	b.location = location
+	return b
+}
+
+// Retry sets the policy failed executions are retried with,
+// both handler errors and backend errors are retried
+func (b *Builder) Retry(policy models.RetryPolicy) *Builder {
+	b.retry = &policy
+	return b
+}
+
+// Timeout bounds a single execution, the handler context is cancelled after the given duration,
+// the run is recorded as timed out and the lock is released. A handler ignoring its context is not stopped,
+// it keeps running while the task may be run again by any node.
+func (b *Builder) Timeout(timeout time.Duration) *Builder {
+	b.timeout = timeout
+	return b
+}
+
 func (b *Builder) Seconds() *Do {
 	b.interval = time.Duration(b.count) * time.Second
 	b.tickerType = models.TickerInterval
@@ -61,9 +93,9 @@ func (b *Builder) Interval(interval time.Duration) *Do {
 	}
 }
 
-// TODO: this method does not work as expected, it needs additional tests
-func (b *Builder) time(time string) *Do {
-	b.timeStr = time
+// At runs the task once per day at the given time of day, accepts "HH:MM" and "HH:MM:SS" formats
+func (b *Builder) At(timeStr string) *Do {
+	b.timeStr = timeStr
 	b.tickerType = models.TickerTime
 
 	return &Do{
@@ -71,38 +103,123 @@ func (b *Builder) time(time string) *Do {
 	}
 }
 
+// Cron runs the task by a cron expression, both 5-field and 6-field (with seconds) forms are supported,
+// e.g. "0 */15 9-18 * * MON-FRI"
+func (b *Builder) Cron(expr string) *Do {
+	b.cronExpr = expr
+	b.tickerType = models.TickerCron
+
+	return &Do{
+		builder: b,
+	}
+}
+
 type Do struct {
 	builder *Builder
 }
 
 func (d *Do) Do(ctx context.Context, name string, handler func()) error {
-	task := models.Task{
-		Handler:    handler,
-		Interval:   d.builder.interval,
-		Name:       name,
-		TickerType: d.builder.tickerType,
+	var handlerCtx func(ctx context.Context) error
+	if handler != nil {
+		handlerCtx = func(context.Context) error {
+			handler()
+			return nil
+		}
 	}
 
-	if task.Name == "" {
-		return ErrEmptyTaskName
+	return d.DoCtx(ctx, name, handlerCtx)
+}
+
+// DoCtx works like Do, but the handler receives a context which is cancelled when the execution should stop,
+// a returned error marks the execution as failed
+func (d *Do) DoCtx(ctx context.Context, name string, handler func(ctx context.Context) error) error {
+	task, err := d.task(name, handler)
+	if err != nil {
+		return err
+	}
+
+	if err := d.builder.runner.Run(ctx, task); err != nil {
+		return fmt.Errorf("failed to add task: %w", err)
 	}
+	return nil
+}
 
-	if task.TickerType == models.TickerInterval && task.Interval == 0 {
-		return ErrTaskIntervalIsZero
+// Start validates and registers the task and returns right away, the task runs in the background
+// until ctx is done or it is stopped with the handle
+func (d *Do) Start(ctx context.Context, name string, handler func(ctx context.Context) error) (models.TaskHandle, error) {
+	task, err := d.task(name, handler)
+	if err != nil {
+		return nil, err
 	}
 
-	if task.TickerType == models.TickerTime {
+	handle, err := d.builder.runner.Start(ctx, task)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add task: %w", err)
+	}
+	return handle, nil
+}
+
+// Schedule validates and returns the schedule without registering a task, it is used to change
+// the schedule of a running task with Scheduler.Reschedule
+func (d *Do) Schedule() (models.Schedule, error) {
+	schedule := models.Schedule{
+		TickerType: d.builder.tickerType,
+		Interval:   d.builder.interval,
+		Location:   d.builder.location,
+	}
+
+	if schedule.TickerType == models.TickerInterval && schedule.Interval == 0 {
+		return models.Schedule{}, ErrTaskIntervalIsZero
+	}
+
+	if schedule.TickerType == models.TickerTime {
 		hour, minute, second, err := models.ParseTime(d.builder.timeStr)
 		if err != nil {
-			return fmt.Errorf("%w: %s", ErrInvalidTimeFormat, err.Error())
+			return models.Schedule{}, fmt.Errorf("%w: %s", ErrInvalidTimeFormat, err.Error())
 		}
-		task.Hour = hour
-		task.Minute = minute
-		task.Second = second
+		schedule.Hour = hour
+		schedule.Minute = minute
+		schedule.Second = second
 	}
 
-	if err := d.builder.runner.Run(ctx, task); err != nil {
-		return fmt.Errorf("failed to add task: %w", err)
+	if schedule.TickerType == models.TickerCron {
+		cron, err := models.ParseCron(d.builder.cronExpr)
+		if err != nil {
+			return models.Schedule{}, fmt.Errorf("%w: %s", ErrInvalidCronExpression, err.Error())
+		}
+		schedule.Cron = cron
 	}
-	return nil
+
+	return schedule, nil
+}
+
+func (d *Do) task(name string, handler func(ctx context.Context) error) (models.Task, error) {
+	task := models.Task{
+		Handler: handler,
+		Name:    name,
+		Retry:   d.builder.retry,
+		Timeout: d.builder.timeout,
+	}
+
+	if task.Name == "" {
+		return models.Task{}, ErrEmptyTaskName
+	}
+
+	schedule, err := d.Schedule()
+	if err != nil {
+		return models.Task{}, err
+	}
+	task.SetSchedule(schedule)
+
+	if task.Timeout < 0 {
+		return models.Task{}, fmt.Errorf("%w: should be >= 0, got %s", ErrInvalidTimeout, task.Timeout)
+	}
+
+	if task.Retry != nil {
+		if err := task.Retry.Validate(); err != nil {
+			return models.Task{}, fmt.Errorf("%w: %s", ErrInvalidRetryPolicy, err.Error())
+		}
+	}
+
+	return task, nil
 }
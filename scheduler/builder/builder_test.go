@@ -2,6 +2,7 @@ package builder
 
 import (
 	"context"
+	"errors"
 	"github.com/skvoch/reter/scheduler/models"
 	"testing"
 	"time"
@@ -65,7 +66,7 @@ func TestBuilding(t *testing.T) {
 			},
 		},
 		{
-			Name: "#4 Time",
+			Name: "#4 At",
 			BuildFunc: func(t *testing.T) error {
 				controller := gomock.NewController(t)
 				runner := m.NewMockRunner(controller)
@@ -79,7 +80,99 @@ func TestBuilding(t *testing.T) {
 				})
 
 				builder := New(runner, 10)
-				return builder.time("22-15-30").Do(context.Background(), "func", nil)
+				return builder.At("22:15:30").Do(context.Background(), "func", nil)
+			},
+		},
+		{
+			Name: "#5 Cron",
+			BuildFunc: func(t *testing.T) error {
+				schedule, err := models.ParseCron("0 */15 9-18 * * MON-FRI")
+				assert.NoError(t, err)
+
+				controller := gomock.NewController(t)
+				runner := m.NewMockRunner(controller)
+				runner.EXPECT().Run(context.Background(), models.Task{
+					Handler:    nil,
+					Cron:       schedule,
+					Name:       "func",
+					TickerType: models.TickerCron,
+				})
+
+				builder := New(runner, 0)
+				return builder.Cron("0 */15 9-18 * * MON-FRI").Do(context.Background(), "func", nil)
+			},
+		},
+		{
+			Name: "#6 At in location",
+			BuildFunc: func(t *testing.T) error {
+				location := time.FixedZone("UTC+3", 3*60*60)
+
+				controller := gomock.NewController(t)
+				runner := m.NewMockRunner(controller)
+				runner.EXPECT().Run(context.Background(), models.Task{
+					Handler:    nil,
+					Hour:       9,
+					Minute:     30,
+					Location:   location,
+					Name:       "func",
+					TickerType: models.TickerTime,
+				})
+
+				builder := New(runner, 0)
+				return builder.In(location).At("09:30").Do(context.Background(), "func", nil)
+			},
+		},
+		{
+			Name: "#7 DoCtx",
+			BuildFunc: func(t *testing.T) error {
+				handlerErr := errors.New("handler error")
+
+				controller := gomock.NewController(t)
+				runner := m.NewMockRunner(controller)
+				runner.EXPECT().Run(context.Background(), gomock.Any()).DoAndReturn(func(ctx context.Context, task models.Task) error {
+					assert.Equal(t, "func", task.Name)
+					assert.ErrorIs(t, task.Handler(ctx), handlerErr)
+					return nil
+				})
+
+				builder := New(runner, 10)
+				return builder.Seconds().DoCtx(context.Background(), "func", func(ctx context.Context) error {
+					return handlerErr
+				})
+			},
+		},
+		{
+			Name: "#8 Timeout",
+			BuildFunc: func(t *testing.T) error {
+				controller := gomock.NewController(t)
+				runner := m.NewMockRunner(controller)
+				runner.EXPECT().Run(context.Background(), models.Task{
+					Handler:    nil,
+					Interval:   time.Minute,
+					Timeout:    time.Second * 30,
+					Name:       "func",
+					TickerType: models.TickerInterval,
+				})
+
+				builder := New(runner, 1)
+				return builder.Timeout(time.Second*30).Minute().Do(context.Background(), "func", nil)
+			},
+		},
+		{
+			Name: "#9 Start",
+			BuildFunc: func(t *testing.T) error {
+				controller := gomock.NewController(t)
+				runner := m.NewMockRunner(controller)
+				runner.EXPECT().Start(context.Background(), models.Task{
+					Handler:    nil,
+					Interval:   time.Minute * 10,
+					Name:       "func",
+					TickerType: models.TickerInterval,
+				})
+
+				builder := New(runner, 10)
+				_, err := builder.Minute().Start(context.Background(), "func", nil)
+				return err
 			},
 		},
 	}
@@ -127,7 +220,7 @@ func TestIncorrectInputs(t *testing.T) {
 				runner := m.NewMockRunner(controller)
 
 				builder := New(runner, 0)
-				return builder.time("rude-invalid-string").Do(context.Background(), "task", func() {})
+				return builder.At("rude-invalid-string").Do(context.Background(), "task", func() {})
 			},
 			Error: ErrInvalidTimeFormat,
 		},
@@ -138,7 +231,7 @@ func TestIncorrectInputs(t *testing.T) {
 				runner := m.NewMockRunner(controller)
 
 				builder := New(runner, 0)
-				return builder.time("24-68-00").Do(context.Background(), "task", func() {})
+				return builder.At("24:68:00").Do(context.Background(), "task", func() {})
 			},
 			Error: ErrInvalidTimeFormat,
 		},
@@ -149,7 +242,7 @@ func TestIncorrectInputs(t *testing.T) {
 				runner := m.NewMockRunner(controller)
 
 				builder := New(runner, 0)
-				return builder.time("25-00-00").Do(context.Background(), "task", func() {})
+				return builder.At("23:60:00").Do(context.Background(), "task", func() {})
 			},
 			Error: ErrInvalidTimeFormat,
 		},
@@ -160,10 +253,55 @@ func TestIncorrectInputs(t *testing.T) {
 				runner := m.NewMockRunner(controller)
 
 				builder := New(runner, 0)
-				return builder.time("23-00-88").Do(context.Background(), "task", func() {})
+				return builder.At("23:00:88").Do(context.Background(), "task", func() {})
 			},
 			Error: ErrInvalidTimeFormat,
 		},
+		{
+			Name: "#6 invalid cron expression",
+			BuildFunc: func(t *testing.T) error {
+				controller := gomock.NewController(t)
+				runner := m.NewMockRunner(controller)
+
+				builder := New(runner, 0)
+				return builder.Cron("0 25 * * *").Do(context.Background(), "task", func() {})
+			},
+			Error: ErrInvalidCronExpression,
+		},
+		{
+			Name: "#7 invalid retry policy",
+			BuildFunc: func(t *testing.T) error {
+				controller := gomock.NewController(t)
+				runner := m.NewMockRunner(controller)
+
+				builder := New(runner, 10)
+				return builder.Retry(models.RetryPolicy{InitialInterval: time.Second}).Seconds().Do(context.Background(), "task", func() {})
+			},
+			Error: ErrInvalidRetryPolicy,
+		},
+		{
+			Name: "#8 negative timeout",
+			BuildFunc: func(t *testing.T) error {
+				controller := gomock.NewController(t)
+				runner := m.NewMockRunner(controller)
+
+				builder := New(runner, 10)
+				return builder.Timeout(-time.Second).Seconds().Do(context.Background(), "task", func() {})
+			},
+			Error: ErrInvalidTimeout,
+		},
+		{
+			Name: "#9 empty task name on start",
+			BuildFunc: func(t *testing.T) error {
+				controller := gomock.NewController(t)
+				runner := m.NewMockRunner(controller)
+
+				builder := New(runner, 10)
+				_, err := builder.Seconds().Start(context.Background(), "", func(context.Context) error { return nil })
+				return err
+			},
+			Error: ErrEmptyTaskName,
+		},
 	}
 
 	for _, c := range cases {
@@ -173,3 +311,44 @@ func TestIncorrectInputs(t *testing.T) {
 		})
 	}
 }
+
+func TestSchedule(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Do       func(b *Builder) *Do
+		Expected models.Schedule
+		Error    error
+	}{
+		{
+			Name:     "#1 interval",
+			Do:       func(b *Builder) *Do { return b.Interval(time.Minute) },
+			Expected: models.Schedule{TickerType: models.TickerInterval, Interval: time.Minute},
+		},
+		{
+			Name:     "#2 time of day",
+			Do:       func(b *Builder) *Do { return b.In(time.UTC).At("09:30") },
+			Expected: models.Schedule{TickerType: models.TickerTime, Hour: 9, Minute: 30, Location: time.UTC},
+		},
+		{
+			Name:  "#3 zero interval",
+			Do:    func(b *Builder) *Do { return b.Seconds() },
+			Error: ErrTaskIntervalIsZero,
+		},
+		{
+			Name:  "#4 invalid cron",
+			Do:    func(b *Builder) *Do { return b.Cron("* * *") },
+			Error: ErrInvalidCronExpression,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			controller := gomock.NewController(t)
+			runner := m.NewMockRunner(controller)
+
+			schedule, err := c.Do(New(runner, 0)).Schedule()
+			assert.ErrorIs(t, err, c.Error)
+			assert.Equal(t, c.Expected, schedule)
+		})
+	}
+}
@@ -47,3 +47,18 @@ func (mr *MockRunnerMockRecorder) Run(ctx, task interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Run", reflect.TypeOf((*MockRunner)(nil).Run), ctx, task)
 }
+
+// Start mocks base method
+func (m *MockRunner) Start(ctx context.Context, task models.Task) (models.TaskHandle, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Start", ctx, task)
+	ret0, _ := ret[0].(models.TaskHandle)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Start indicates an expected call of Start
+func (mr *MockRunnerMockRecorder) Start(ctx, task interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Start", reflect.TypeOf((*MockRunner)(nil).Start), ctx, task)
+}
@@ -0,0 +1,43 @@
+package scheduler
+
+import "context"
+
+type attemptKey struct{}
+
+// Attempt returns the number of the current attempt of the execution, starting from 1,
+// it is available in the context passed to task handlers
+func Attempt(ctx context.Context) int {
+	attempt, ok := ctx.Value(attemptKey{}).(int)
+	if !ok {
+		return 1
+	}
+	return attempt
+}
+
+func withAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, attemptKey{}, attempt)
+}
+
+type taskEntryKey struct{}
+
+func withTaskEntry(ctx context.Context, entry *taskEntry) context.Context {
+	return context.WithValue(ctx, taskEntryKey{}, entry)
+}
+
+// taskEntryFromContext returns the entry of the task the execution belongs to, nil if the task has not been started
+func taskEntryFromContext(ctx context.Context) *taskEntry {
+	entry, _ := ctx.Value(taskEntryKey{}).(*taskEntry)
+	return entry
+}
+
+type triggeredKey struct{}
+
+// withTriggered marks the execution requested with TriggerNow, it runs regardless of the schedule
+func withTriggered(ctx context.Context) context.Context {
+	return context.WithValue(ctx, triggeredKey{}, true)
+}
+
+func isTriggered(ctx context.Context) bool {
+	triggered, _ := ctx.Value(triggeredKey{}).(bool)
+	return triggered
+}
@@ -0,0 +1,98 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/skvoch/reter/scheduler/backend"
+	"github.com/skvoch/reter/scheduler/logger"
+)
+
+const (
+	controlRetryInterval = time.Second
+	// triggerRetryInterval is the interval a triggered run tries to take the lock held by another run at
+	triggerRetryInterval = time.Second
+)
+
+// watchControl follows the cluster-wide control commands if the backend supports them, until shutdown
+func (i *impl) watchControl() {
+	controller, ok := i.backend.(backend.Controller)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	i.stopControlling = cancel
+
+	go func() {
+		for {
+			err := controller.WatchControl(ctx, controlHandler{i})
+			if ctx.Err() != nil {
+				return
+			}
+			i.logger.Log(ctx, logger.LogLevelError, "failed to watch control commands", map[string]interface{}{"error": err})
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(controlRetryInterval):
+			}
+		}
+	}()
+}
+
+// claimTrigger runs the task if it has been triggered while no node was running it
+func (i *impl) claimTrigger(ctx context.Context, entry *taskEntry) {
+	controller, ok := i.backend.(backend.Controller)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := i.contextWithTimeout(ctx)
+	defer cancel()
+
+	claimed, err := controller.ClaimTrigger(ctx, entry.name)
+	if err != nil {
+		i.logger.Log(ctx, logger.LogLevelError, "failed to claim trigger", map[string]interface{}{"task_name": entry.name, "error": err})
+		return
+	}
+	if claimed {
+		entry.TriggerNow()
+	}
+}
+
+func (i *impl) isClusterPaused(taskName string) bool {
+	i.clusterPausedMx.Lock()
+	defer i.clusterPausedMx.Unlock()
+
+	return i.clusterPaused[taskName]
+}
+
+// controlHandler applies the control commands of the backend to the tasks of the scheduler
+type controlHandler struct {
+	i *impl
+}
+
+func (h controlHandler) SetPaused(taskName string, paused bool) {
+	h.i.clusterPausedMx.Lock()
+	defer h.i.clusterPausedMx.Unlock()
+
+	if paused {
+		h.i.clusterPaused[taskName] = true
+	} else {
+		delete(h.i.clusterPaused, taskName)
+	}
+}
+
+func (h controlHandler) HasTask(taskName string) bool {
+	_, err := h.i.task(taskName)
+	return err == nil
+}
+
+func (h controlHandler) Trigger(taskName string) {
+	entry, err := h.i.task(taskName)
+	if err != nil {
+		return
+	}
+	entry.TriggerNow()
+}
@@ -0,0 +1,208 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/skvoch/reter/scheduler/backend"
+	"github.com/skvoch/reter/scheduler/builder"
+	"github.com/skvoch/reter/scheduler/logger"
+	"github.com/skvoch/reter/scheduler/models"
+)
+
+func (i *impl) RegisterHandler(name string, handler models.HandlerFunc) error {
+	if handler == nil {
+		return ErrNilHandler
+	}
+
+	i.handlersMx.Lock()
+	defer i.handlersMx.Unlock()
+
+	if _, ok := i.handlers[name]; ok {
+		return fmt.Errorf("%w: %s", ErrNotUniqueHandlerName, name)
+	}
+	i.handlers[name] = handler
+	return nil
+}
+
+func (i *impl) registeredHandler(name string) (models.HandlerFunc, error) {
+	i.handlersMx.Lock()
+	defer i.handlersMx.Unlock()
+
+	handler, ok := i.handlers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrHandlerNotFound, name)
+	}
+	return handler, nil
+}
+
+func (i *impl) WatchDefinitions(ctx context.Context) error {
+	source, ok := i.backend.(backend.DefinitionSource)
+	if !ok {
+		return ErrDefinitionsNotSupported
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-i.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	handler := &definitionHandler{
+		i:     i,
+		ctx:   ctx,
+		tasks: make(map[string]definedTask),
+	}
+	defer handler.removeAll()
+
+	for {
+		err := source.WatchDefinitions(ctx, handler)
+		if ctx.Err() != nil {
+			return nil
+		}
+		i.logger.Log(ctx, logger.LogLevelError, "failed to watch task definitions", map[string]interface{}{"error": err})
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(controlRetryInterval):
+		}
+	}
+}
+
+// startDefinition validates the definition and starts its task like the builder does
+func (i *impl) startDefinition(ctx context.Context, definition models.Definition) (models.TaskHandle, error) {
+	handler, err := i.registeredHandler(definition.Handler)
+	if err != nil {
+		return nil, err
+	}
+
+	b := builder.New(i, 0)
+
+	if definition.Location != "" {
+		location, err := time.LoadLocation(definition.Location)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidDefinition, err.Error())
+		}
+		b.In(location)
+	}
+
+	if definition.Timeout != "" {
+		timeout, err := time.ParseDuration(definition.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidDefinition, err.Error())
+		}
+		b.Timeout(timeout)
+	}
+
+	var (
+		do        *builder.Do
+		schedules int
+	)
+	if definition.Interval != "" {
+		schedules++
+
+		interval, err := time.ParseDuration(definition.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidDefinition, err.Error())
+		}
+		do = b.Interval(interval)
+	}
+	if definition.At != "" {
+		schedules++
+		do = b.At(definition.At)
+	}
+	if definition.Cron != "" {
+		schedules++
+		do = b.Cron(definition.Cron)
+	}
+	if schedules != 1 {
+		return nil, fmt.Errorf("%w: exactly one of interval, at and cron has to be set", ErrInvalidDefinition)
+	}
+
+	args := definition.Args
+	return do.Start(ctx, definition.Name, func(ctx context.Context) error {
+		return handler(ctx, args)
+	})
+}
+
+type definedTask struct {
+	spec   string
+	handle models.TaskHandle
+}
+
+// definitionHandler reconciles the tasks started from definitions with the definitions of the backend
+type definitionHandler struct {
+	i   *impl
+	ctx context.Context
+
+	mx    sync.Mutex
+	tasks map[string]definedTask
+}
+
+// PutDefinition starts the task of a new definition and restarts the task of a changed one,
+// a running execution of the previous definition is cancelled. Tasks of invalid definitions are not run.
+func (h *definitionHandler) PutDefinition(name string, spec []byte) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	current, ok := h.tasks[name]
+	if ok && current.spec == string(spec) {
+		return
+	}
+
+	if ok {
+		current.handle.Remove()
+		delete(h.tasks, name)
+	}
+
+	definition, err := models.ParseDefinition(spec)
+	if err == nil && definition.Name != "" && definition.Name != name {
+		err = fmt.Errorf("%w: name %s does not match the key %s", ErrInvalidDefinition, definition.Name, name)
+	}
+	if err != nil {
+		h.i.logger.Log(h.ctx, logger.LogLevelError, "invalid task definition", map[string]interface{}{"task_name": name, "error": err})
+		return
+	}
+	definition.Name = name
+
+	handle, err := h.i.startDefinition(h.ctx, definition)
+	if err != nil {
+		h.i.logger.Log(h.ctx, logger.LogLevelError, "failed to start defined task", map[string]interface{}{"task_name": name, "error": err})
+		return
+	}
+
+	h.tasks[name] = definedTask{
+		spec:   string(spec),
+		handle: handle,
+	}
+}
+
+func (h *definitionHandler) DeleteDefinition(name string) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if current, ok := h.tasks[name]; ok {
+		current.handle.Remove()
+		delete(h.tasks, name)
+	}
+}
+
+// removeAll removes the defined tasks and waits for them to end
+func (h *definitionHandler) removeAll() {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	for name, current := range h.tasks {
+		current.handle.Remove()
+		current.handle.Wait()
+		delete(h.tasks, name)
+	}
+}
@@ -0,0 +1,73 @@
+// Package schedulertest holds the checks shared by the scheduler tests of the backends
+package schedulertest
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skvoch/reter/scheduler/builder"
+)
+
+const (
+	nodes    = 2
+	interval = time.Millisecond * 50
+	ticks    = 10
+	// minExecutions leaves room for a tick or two lost to a slow test machine, skipping every other tick is caught
+	minExecutions = 8
+)
+
+// Scheduler is the part of scheduler.Scheduler the checks use
+type Scheduler interface {
+	Every(count ...uint) *builder.Builder
+}
+
+// CheckIntervalTask runs an interval task on two nodes sharing one backend for ten intervals, the executions
+// must not overlap and every interval has to be run once
+func CheckIntervalTask(t *testing.T, newNode func() Scheduler) {
+	var (
+		running    int32
+		overlapped int32
+		executions int32
+		wg         sync.WaitGroup
+	)
+
+	schedulers := make([]Scheduler, 0, nodes)
+	for n := 0; n < nodes; n++ {
+		schedulers = append(schedulers, newNode())
+	}
+
+	// the context ends between the last tick and the next one
+	ctx, cancel := context.WithTimeout(context.Background(), interval*ticks+interval/2)
+	defer cancel()
+
+	for _, s := range schedulers {
+		s := s
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.Every().Interval(interval).DoCtx(ctx, "task", func(ctx context.Context) error {
+				if atomic.AddInt32(&running, 1) > 1 {
+					atomic.StoreInt32(&overlapped, 1)
+				}
+				defer atomic.AddInt32(&running, -1)
+
+				atomic.AddInt32(&executions, 1)
+				time.Sleep(interval / 5)
+				return nil
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(0), overlapped)
+	// both nodes tick on every interval, but every interval is run once
+	assert.GreaterOrEqual(t, executions, int32(minExecutions))
+	assert.LessOrEqual(t, executions, int32(ticks))
+}
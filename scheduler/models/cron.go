@@ -0,0 +1,266 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSearchYears limits how far Next looks ahead, "0 0 29 FEB *" may need up to 8 years.
+const cronSearchYears = 10
+
+var (
+	cronMonthNames = map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}
+	cronDayNames = map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}
+)
+
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	cronSecond = cronField{name: "second", min: 0, max: 59}
+	cronMinute = cronField{name: "minute", min: 0, max: 59}
+	cronHour   = cronField{name: "hour", min: 0, max: 23}
+	cronDom    = cronField{name: "day of month", min: 1, max: 31}
+	cronMonth  = cronField{name: "month", min: 1, max: 12, names: cronMonthNames}
+	// 7 is an alias for sunday, it is folded into 0 after parsing
+	cronDow = cronField{name: "day of week", min: 0, max: 7, names: cronDayNames}
+)
+
+// CronSchedule is a parsed cron expression, each field is stored as a bit set of allowed values.
+type CronSchedule struct {
+	expr string
+
+	second, minute, hour, dom, month, dow uint64
+	// domAny and dowAny are set when the field is "*" or "?", if both day fields
+	// are restricted a day matches when either of them matches (as in classic cron)
+	domAny, dowAny bool
+}
+
+// ParseCron parses standard 5-field ("min hour dom month dow") and
+// 6-field ("sec min hour dom month dow") cron expressions.
+// Fields support "*", "?", lists "1,2", ranges "1-5", steps "*/15", "10-40/5" and
+// three-letter month (JAN-DEC) and day (SUN-SAT) names.
+func ParseCron(expr string) (*CronSchedule, error) {
+	fields := strings.Fields(expr)
+
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("expected 5 or 6 fields, got %d", len(fields))
+	}
+
+	out := &CronSchedule{expr: strings.Join(fields, " ")}
+	targets := []struct {
+		field cronField
+		bits  *uint64
+		any   *bool
+	}{
+		{field: cronSecond, bits: &out.second},
+		{field: cronMinute, bits: &out.minute},
+		{field: cronHour, bits: &out.hour},
+		{field: cronDom, bits: &out.dom, any: &out.domAny},
+		{field: cronMonth, bits: &out.month},
+		{field: cronDow, bits: &out.dow, any: &out.dowAny},
+	}
+
+	for idx, target := range targets {
+		bits, err := parseCronField(fields[idx], target.field)
+		if err != nil {
+			return nil, err
+		}
+		*target.bits = bits
+
+		if target.any != nil {
+			*target.any = fields[idx] == "*" || fields[idx] == "?"
+		}
+	}
+
+	if out.dow&(1<<7) != 0 {
+		out.dow = out.dow&^(1<<7) | 1
+	}
+
+	if !out.canFire() {
+		return nil, fmt.Errorf("expression %q never fires", expr)
+	}
+	return out, nil
+}
+
+func parseCronField(value string, field cronField) (uint64, error) {
+	var out uint64
+
+	for _, part := range strings.Split(value, ",") {
+		bits, err := parseCronRange(part, field)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse %s %q: %w", field.name, value, err)
+		}
+		out |= bits
+	}
+	return out, nil
+}
+
+func parseCronRange(value string, field cronField) (uint64, error) {
+	var (
+		start, end = field.min, field.max
+		step       = 1
+		err        error
+	)
+
+	rangePart := value
+	if idx := strings.IndexByte(value, '/'); idx >= 0 {
+		rangePart = value[:idx]
+		if step, err = strconv.Atoi(value[idx+1:]); err != nil || step <= 0 {
+			return 0, fmt.Errorf("invalid step %q", value[idx+1:])
+		}
+	}
+
+	switch {
+	case rangePart == "*" || rangePart == "?":
+	case strings.Contains(rangePart, "-"):
+		bounds := strings.SplitN(rangePart, "-", 2)
+		if start, err = parseCronValue(bounds[0], field); err != nil {
+			return 0, err
+		}
+		if end, err = parseCronValue(bounds[1], field); err != nil {
+			return 0, err
+		}
+		if start > end {
+			return 0, fmt.Errorf("range start %d is greater than end %d", start, end)
+		}
+	default:
+		if start, err = parseCronValue(rangePart, field); err != nil {
+			return 0, err
+		}
+		// "5/10" means starting from 5 with step 10, a plain "5" is a single value
+		if step == 1 {
+			end = start
+		}
+	}
+
+	var out uint64
+	for v := start; v <= end; v += step {
+		out |= 1 << uint(v)
+	}
+	return out, nil
+}
+
+func parseCronValue(value string, field cronField) (int, error) {
+	if v, ok := field.names[strings.ToUpper(value)]; ok {
+		return v, nil
+	}
+
+	out, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	if out < field.min || out > field.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", out, field.min, field.max)
+	}
+	return out, nil
+}
+
+// canFire reports false for expressions like "0 0 30 FEB *" that never match a real date.
+func (s *CronSchedule) canFire() bool {
+	// a restricted day of week matches some day of any month
+	if s.domAny || !s.dowAny {
+		return true
+	}
+
+	for month := time.January; month <= time.December; month++ {
+		if s.month&(1<<uint(month)) == 0 {
+			continue
+		}
+		// 2020 is a leap year, so February gets all of its 29 days
+		days := time.Date(2020, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		for day := 1; day <= days; day++ {
+			if s.dom&(1<<uint(day)) != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *CronSchedule) String() string {
+	return s.expr
+}
+
+// Next returns the first fire time strictly after the given time,
+// the schedule is evaluated in the location of the given time.
+// Fire times skipped by a DST transition fire at the moment of the transition,
+// fire times within a repeated hour fire only once.
+// Zero time is returned if there is no fire time in the next cronSearchYears years.
+func (s *CronSchedule) Next(after time.Time) time.Time {
+	loc := after.Location()
+
+	// calendar days are walked in UTC, so DST transitions do not affect the iteration
+	day := time.Date(after.Year(), after.Month(), after.Day(), 0, 0, 0, 0, time.UTC)
+	limit := day.AddDate(cronSearchYears, 0, 0)
+
+	for ; day.Before(limit); day = day.AddDate(0, 0, 1) {
+		if !s.matchDay(day) {
+			continue
+		}
+		if out, ok := s.nextInDay(day, after, loc); ok {
+			return out
+		}
+	}
+	return time.Time{}
+}
+
+func (s *CronSchedule) matchDay(day time.Time) bool {
+	if s.month&(1<<uint(day.Month())) == 0 {
+		return false
+	}
+
+	domMatch := s.dom&(1<<uint(day.Day())) != 0
+	dowMatch := s.dow&(1<<uint(day.Weekday())) != 0
+
+	if !s.domAny && !s.dowAny {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+func (s *CronSchedule) nextInDay(day, after time.Time, loc *time.Location) (time.Time, bool) {
+	year, month, dom := day.Date()
+
+	for hour := 0; hour < 24; hour++ {
+		if s.hour&(1<<uint(hour)) == 0 {
+			continue
+		}
+		if !Date(year, month, dom, hour, 59, 59, loc).After(after) {
+			continue
+		}
+
+		for minute := 0; minute < 60; minute++ {
+			if s.minute&(1<<uint(minute)) == 0 {
+				continue
+			}
+			if !Date(year, month, dom, hour, minute, 59, loc).After(after) {
+				continue
+			}
+
+			for second := 0; second < 60; second++ {
+				if s.second&(1<<uint(second)) == 0 {
+					continue
+				}
+				if out := Date(year, month, dom, hour, minute, second, loc); out.After(after) {
+					return out, true
+				}
+			}
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,171 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCron(t *testing.T) {
+	cases := []struct {
+		Name    string
+		Expr    string
+		IsValid bool
+	}{
+		{Name: "#1 five fields", Expr: "*/15 9-18 * * MON-FRI", IsValid: true},
+		{Name: "#2 six fields", Expr: "0 */15 9-18 * * MON-FRI", IsValid: true},
+		{Name: "#3 lists and names", Expr: "0 0 1,15 JAN,jul SUN", IsValid: true},
+		{Name: "#4 sunday as 7", Expr: "0 12 * * 7", IsValid: true},
+		{Name: "#5 range with step", Expr: "10-40/10 * * * *", IsValid: true},
+		{Name: "#6 too few fields", Expr: "* * * *", IsValid: false},
+		{Name: "#7 too many fields", Expr: "* * * * * * *", IsValid: false},
+		{Name: "#8 minute out of range", Expr: "60 * * * *", IsValid: false},
+		{Name: "#9 zero day of month", Expr: "0 0 0 * *", IsValid: false},
+		{Name: "#10 inverted range", Expr: "0 18-9 * * *", IsValid: false},
+		{Name: "#11 zero step", Expr: "*/0 * * * *", IsValid: false},
+		{Name: "#12 unknown name", Expr: "0 0 * * MOO", IsValid: false},
+		{Name: "#13 never fires", Expr: "0 0 30 FEB *", IsValid: false},
+		{Name: "#14 empty", Expr: "", IsValid: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			_, err := ParseCron(c.Expr)
+			if c.IsValid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	cases := []struct {
+		Name   string
+		Expr   string
+		After  time.Time
+		Expect time.Time
+	}{
+		{
+			Name:   "#1 every 15 minutes in working hours",
+			Expr:   "0 */15 9-18 * * MON-FRI",
+			After:  time.Date(2021, 6, 1, 9, 7, 0, 0, time.UTC),
+			Expect: time.Date(2021, 6, 1, 9, 15, 0, 0, time.UTC),
+		},
+		{
+			Name:   "#2 after working hours moves to the next day",
+			Expr:   "0 */15 9-18 * * MON-FRI",
+			After:  time.Date(2021, 6, 1, 18, 45, 0, 0, time.UTC),
+			Expect: time.Date(2021, 6, 2, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:   "#3 friday evening moves to monday",
+			Expr:   "0 */15 9-18 * * MON-FRI",
+			After:  time.Date(2021, 6, 4, 19, 0, 0, 0, time.UTC),
+			Expect: time.Date(2021, 6, 7, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:   "#4 strictly after",
+			Expr:   "30 * * * * *",
+			After:  time.Date(2021, 6, 1, 10, 0, 30, 0, time.UTC),
+			Expect: time.Date(2021, 6, 1, 10, 1, 30, 0, time.UTC),
+		},
+		{
+			Name:   "#5 end of year wrap",
+			Expr:   "0 0 1 JAN *",
+			After:  time.Date(2021, 12, 31, 23, 59, 59, 0, time.UTC),
+			Expect: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:   "#6 leap day",
+			Expr:   "0 0 29 2 *",
+			After:  time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC),
+			Expect: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:   "#7 day of month or day of week",
+			Expr:   "0 0 13 * FRI",
+			After:  time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+			Expect: time.Date(2021, 6, 4, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:   "#8 sub-second input",
+			Expr:   "* * * * * *",
+			After:  time.Date(2021, 6, 1, 10, 0, 0, 500, time.UTC),
+			Expect: time.Date(2021, 6, 1, 10, 0, 1, 0, time.UTC),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			schedule, err := ParseCron(c.Expr)
+			assert.NoError(t, err)
+			assert.Equal(t, c.Expect, schedule.Next(c.After))
+		})
+	}
+}
+
+func TestCronNextDST(t *testing.T) {
+	newYork := mustLoadLocation(t, "America/New_York")
+
+	cases := []struct {
+		Name   string
+		Expr   string
+		After  time.Time
+		Expect []time.Time
+	}{
+		{
+			Name:  "#1 daily job in the skipped hour runs at the transition",
+			Expr:  "0 30 2 * * *",
+			After: time.Date(2021, time.March, 13, 12, 0, 0, 0, newYork),
+			Expect: []time.Time{
+				time.Date(2021, time.March, 14, 7, 0, 0, 0, time.UTC),
+				time.Date(2021, time.March, 15, 6, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			Name:  "#2 hourly job skips the missing hour",
+			Expr:  "0 0 * * * *",
+			After: time.Date(2021, time.March, 14, 0, 30, 0, 0, newYork),
+			Expect: []time.Time{
+				time.Date(2021, time.March, 14, 6, 0, 0, 0, time.UTC), // 01:00 EST
+				time.Date(2021, time.March, 14, 7, 0, 0, 0, time.UTC), // 03:00 EDT
+				time.Date(2021, time.March, 14, 8, 0, 0, 0, time.UTC), // 04:00 EDT
+			},
+		},
+		{
+			Name:  "#3 job in the repeated hour runs once",
+			Expr:  "0 */30 1 * * *",
+			After: time.Date(2021, time.November, 7, 0, 45, 0, 0, newYork),
+			Expect: []time.Time{
+				time.Date(2021, time.November, 7, 5, 0, 0, 0, time.UTC),  // 01:00 EDT
+				time.Date(2021, time.November, 7, 5, 30, 0, 0, time.UTC), // 01:30 EDT
+				time.Date(2021, time.November, 8, 6, 0, 0, 0, time.UTC),  // 01:00 EST next day
+			},
+		},
+		{
+			Name:  "#4 hourly job across the repeated hour",
+			Expr:  "0 0 * * * *",
+			After: time.Date(2021, time.November, 7, 0, 30, 0, 0, newYork),
+			Expect: []time.Time{
+				time.Date(2021, time.November, 7, 5, 0, 0, 0, time.UTC), // 01:00 EDT
+				time.Date(2021, time.November, 7, 7, 0, 0, 0, time.UTC), // 02:00 EST
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			schedule, err := ParseCron(c.Expr)
+			assert.NoError(t, err)
+
+			after := c.After
+			for _, expect := range c.Expect {
+				after = schedule.Next(after)
+				assert.True(t, expect.Equal(after), "expected %v, got %v", expect, after.UTC())
+			}
+		})
+	}
+}
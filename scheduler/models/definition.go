@@ -0,0 +1,38 @@
+package models
+
+import (
+	"context"
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// HandlerFunc is a handler registered by name, so it can be referenced by task definitions
+type HandlerFunc func(ctx context.Context, args map[string]string) error
+
+// Definition is a task spec kept in the backend, so tasks can be added, changed and deleted without a redeploy.
+// Exactly one of Interval, At and Cron has to be set.
+type Definition struct {
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Interval is a duration, e.g. "10m"
+	Interval string `json:"interval,omitempty" yaml:"interval,omitempty"`
+	// At is a time of day in "HH:MM" or "HH:MM:SS" format
+	At   string `json:"at,omitempty" yaml:"at,omitempty"`
+	Cron string `json:"cron,omitempty" yaml:"cron,omitempty"`
+	// Location is a time zone name, e.g. "Europe/Berlin"
+	Location string `json:"location,omitempty" yaml:"location,omitempty"`
+	Timeout  string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+
+	// Handler is the name the handler has been registered with, Args are passed to it on every execution
+	Handler string            `json:"handler" yaml:"handler"`
+	Args    map[string]string `json:"args,omitempty" yaml:"args,omitempty"`
+}
+
+// ParseDefinition parses a definition in YAML or JSON format, unknown fields are rejected
+func ParseDefinition(data []byte) (Definition, error) {
+	var out Definition
+	if err := yaml.UnmarshalStrict(data, &out); err != nil {
+		return Definition{}, fmt.Errorf("failed to parse definition: %w", err)
+	}
+	return out, nil
+}
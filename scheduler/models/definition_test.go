@@ -0,0 +1,58 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDefinition(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Input    string
+		Expected Definition
+		IsValid  bool
+	}{
+		{
+			Name:     "#1 json",
+			Input:    `{"name": "report", "cron": "0 9 * * MON", "handler": "send-report", "args": {"to": "team", "limit": 10}}`,
+			Expected: Definition{Name: "report", Cron: "0 9 * * MON", Handler: "send-report", Args: map[string]string{"to": "team", "limit": "10"}},
+			IsValid:  true,
+		},
+		{
+			Name:     "#2 yaml",
+			Input:    "name: cleanup\ninterval: 10m\ntimeout: 1m\nhandler: cleanup\n",
+			Expected: Definition{Name: "cleanup", Interval: "10m", Timeout: "1m", Handler: "cleanup"},
+			IsValid:  true,
+		},
+		{
+			Name:     "#3 daily in a time zone",
+			Input:    "at: \"09:30\"\nlocation: Europe/Berlin\nhandler: digest\n",
+			Expected: Definition{At: "09:30", Location: "Europe/Berlin", Handler: "digest"},
+			IsValid:  true,
+		},
+		{
+			Name:    "#4 unknown field",
+			Input:   `{"name": "report", "schedule": "daily", "handler": "send-report"}`,
+			IsValid: false,
+		},
+		{
+			Name:    "#5 malformed",
+			Input:   `{"name": "report"`,
+			IsValid: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			out, err := ParseDefinition([]byte(c.Input))
+			if !c.IsValid {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.Expected, out)
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Execution is a record of a single execution of a task in its history
+type Execution struct {
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Duration time.Duration `json:"duration"`
+	// NodeID is the id of the node which has run the execution, RunID is unique for every execution
+	NodeID  string  `json:"node_id"`
+	RunID   string  `json:"run_id,omitempty"`
+	Outcome Outcome `json:"outcome"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// Retention limits the execution history of a task, zero fields mean no limit
+type Retention struct {
+	// MaxCount is the number of the latest executions which are kept
+	MaxCount int
+	// MaxAge drops the executions started earlier than that before the latest one
+	MaxAge time.Duration
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const defaultRetryMultiplier = 2
+
+// RetryPolicy describes how failed executions are retried with exponential backoff,
+// at least one of MaxAttempts and MaxElapsedTime has to be set
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first one, zero means no limit
+	MaxAttempts int
+	// InitialInterval is the delay before the first retry
+	InitialInterval time.Duration
+	// MaxInterval caps the delay between attempts, zero means no cap
+	MaxInterval time.Duration
+	// Multiplier is applied to the delay after every retry, 2 is used if it is zero
+	Multiplier float64
+	// Jitter randomizes every delay by up to the given fraction of it, e.g. 0.2 means +-20%
+	Jitter float64
+	// MaxElapsedTime stops retrying when the next attempt would start later than that since the first one,
+	// zero means no limit
+	MaxElapsedTime time.Duration
+}
+
+func (p RetryPolicy) Validate() error {
+	switch {
+	case p.InitialInterval <= 0:
+		return fmt.Errorf("initial interval should be > 0")
+	case p.MaxAttempts < 0:
+		return fmt.Errorf("max attempts should be >= 0")
+	case p.MaxAttempts == 0 && p.MaxElapsedTime <= 0:
+		return fmt.Errorf("max attempts or max elapsed time should be set")
+	case p.Multiplier != 0 && p.Multiplier < 1:
+		return fmt.Errorf("multiplier should be >= 1")
+	case p.Jitter < 0 || p.Jitter > 1:
+		return fmt.Errorf("jitter should be >= 0 and <= 1")
+	case p.MaxInterval < 0:
+		return fmt.Errorf("max interval should be >= 0")
+	}
+	return nil
+}
+
+// Backoff returns the delay before the next attempt after the given one, attempts are counted from 1
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = defaultRetryMultiplier
+	}
+
+	delay := float64(p.InitialInterval) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxInterval > 0 && delay > float64(p.MaxInterval) {
+		delay = float64(p.MaxInterval)
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	if delay > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(delay)
+}
+
+// CanRetry reports whether one more attempt is allowed after the given one,
+// elapsed is the time from the first attempt until the next one would start
+func (p RetryPolicy) CanRetry(attempt int, elapsed time.Duration) bool {
+	if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+		return false
+	}
+	if p.MaxElapsedTime > 0 && elapsed > p.MaxElapsedTime {
+		return false
+	}
+	return true
+}
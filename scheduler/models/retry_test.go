@@ -0,0 +1,81 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicyValidate(t *testing.T) {
+	cases := []struct {
+		Name    string
+		Policy  RetryPolicy
+		IsValid bool
+	}{
+		{Name: "#1 max attempts", Policy: RetryPolicy{InitialInterval: time.Second, MaxAttempts: 3}, IsValid: true},
+		{Name: "#2 max elapsed time", Policy: RetryPolicy{InitialInterval: time.Second, MaxElapsedTime: time.Minute}, IsValid: true},
+		{Name: "#3 zero initial interval", Policy: RetryPolicy{MaxAttempts: 3}, IsValid: false},
+		{Name: "#4 unbounded", Policy: RetryPolicy{InitialInterval: time.Second}, IsValid: false},
+		{Name: "#5 shrinking multiplier", Policy: RetryPolicy{InitialInterval: time.Second, MaxAttempts: 3, Multiplier: 0.5}, IsValid: false},
+		{Name: "#6 jitter out of range", Policy: RetryPolicy{InitialInterval: time.Second, MaxAttempts: 3, Jitter: 1.5}, IsValid: false},
+		{Name: "#7 negative max attempts", Policy: RetryPolicy{InitialInterval: time.Second, MaxAttempts: -1}, IsValid: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			err := c.Policy.Validate()
+			if c.IsValid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		InitialInterval: time.Second,
+		MaxInterval:     time.Second * 5,
+		MaxAttempts:     10,
+	}
+
+	assert.Equal(t, time.Second, policy.Backoff(1))
+	assert.Equal(t, time.Second*2, policy.Backoff(2))
+	assert.Equal(t, time.Second*4, policy.Backoff(3))
+	assert.Equal(t, time.Second*5, policy.Backoff(4))
+	assert.Equal(t, time.Second*5, policy.Backoff(100))
+
+	policy.Multiplier = 3
+	assert.Equal(t, time.Second*3, policy.Backoff(2))
+
+	policy.Jitter = 0.5
+	for attempt := 1; attempt < 10; attempt++ {
+		delay := policy.Backoff(1)
+		assert.GreaterOrEqual(t, int64(delay), int64(time.Millisecond*500))
+		assert.LessOrEqual(t, int64(delay), int64(time.Millisecond*1500))
+	}
+}
+
+func TestRetryPolicyCanRetry(t *testing.T) {
+	cases := []struct {
+		Name    string
+		Policy  RetryPolicy
+		Attempt int
+		Elapsed time.Duration
+		Expect  bool
+	}{
+		{Name: "#1 attempts left", Policy: RetryPolicy{MaxAttempts: 3}, Attempt: 2, Expect: true},
+		{Name: "#2 attempts exhausted", Policy: RetryPolicy{MaxAttempts: 3}, Attempt: 3, Expect: false},
+		{Name: "#3 time left", Policy: RetryPolicy{MaxElapsedTime: time.Minute}, Attempt: 10, Elapsed: time.Second * 30, Expect: true},
+		{Name: "#4 time is over", Policy: RetryPolicy{MaxElapsedTime: time.Minute}, Attempt: 10, Elapsed: time.Minute * 2, Expect: false},
+		{Name: "#5 both limits, time is over", Policy: RetryPolicy{MaxAttempts: 5, MaxElapsedTime: time.Minute}, Attempt: 2, Elapsed: time.Minute * 2, Expect: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			assert.Equal(t, c.Expect, c.Policy.CanRetry(c.Attempt, c.Elapsed))
+		})
+	}
+}
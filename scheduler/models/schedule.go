@@ -0,0 +1,62 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Schedule tells when a task runs, the schedule of a running task can be changed with Scheduler.Reschedule
+type Schedule struct {
+	TickerType           TickerType
+	Interval             time.Duration
+	Hour, Minute, Second int
+	Cron                 *CronSchedule
+	// Location is used to evaluate daily and cron schedules
+	Location *time.Location
+}
+
+// String describes the schedule, e.g. "every 10s", "daily at 09:30:00 Europe/Berlin" or "cron 0 0 9 * * MON UTC"
+func (s Schedule) String() string {
+	var out string
+	switch s.TickerType {
+	case TickerInterval:
+		return "every " + s.Interval.String()
+	case TickerTime:
+		out = fmt.Sprintf("daily at %02d:%02d:%02d", s.Hour, s.Minute, s.Second)
+	case TickerCron:
+		if s.Cron == nil {
+			return "cron"
+		}
+		out = "cron " + s.Cron.String()
+	default:
+		return s.TickerType.String()
+	}
+
+	if s.Location != nil {
+		out += " " + s.Location.String()
+	}
+	return out
+}
+
+func (t Task) Schedule() Schedule {
+	return Schedule{
+		TickerType: t.TickerType,
+		Interval:   t.Interval,
+		Hour:       t.Hour,
+		Minute:     t.Minute,
+		Second:     t.Second,
+		Cron:       t.Cron,
+		Location:   t.Location,
+	}
+}
+
+// SetSchedule replaces all schedule fields of the task
+func (t *Task) SetSchedule(schedule Schedule) {
+	t.TickerType = schedule.TickerType
+	t.Interval = schedule.Interval
+	t.Hour = schedule.Hour
+	t.Minute = schedule.Minute
+	t.Second = schedule.Second
+	t.Cron = schedule.Cron
+	t.Location = schedule.Location
+}
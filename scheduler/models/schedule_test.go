@@ -0,0 +1,46 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduleString(t *testing.T) {
+	cron, err := ParseCron("0 9 * * MON")
+	assert.NoError(t, err)
+
+	cases := []struct {
+		Name     string
+		Schedule Schedule
+		Expected string
+	}{
+		{
+			Name:     "#1 interval",
+			Schedule: Schedule{TickerType: TickerInterval, Interval: time.Second * 10},
+			Expected: "every 10s",
+		},
+		{
+			Name:     "#2 time of day",
+			Schedule: Schedule{TickerType: TickerTime, Hour: 9, Minute: 30, Location: mustLoadLocation(t, "Europe/Berlin")},
+			Expected: "daily at 09:30:00 Europe/Berlin",
+		},
+		{
+			Name:     "#3 cron",
+			Schedule: Schedule{TickerType: TickerCron, Cron: cron, Location: time.UTC},
+			Expected: "cron 0 0 9 * * MON UTC",
+		},
+		{
+			Name:     "#4 unknown ticker type",
+			Schedule: Schedule{TickerType: 5},
+			Expected: "TickerType(5)",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			assert.Equal(t, c.Expected, c.Schedule.String())
+		})
+	}
+}
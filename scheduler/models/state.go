@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// StateVersion is the version of the State record written by this version of the scheduler
+const StateVersion = 1
+
+// State is the execution state record of a task shared by all nodes
+type State struct {
+	Version int `json:"version"`
+	// LastAction is the last action time the schedule is evaluated against, it is set when a run claims
+	// its schedule slot and reverted if the run fails
+	LastAction *time.Time `json:"last_action,omitempty"`
+	// LastStart and LastFinish belong to the last finished execution, either successful or failed
+	LastStart   *time.Time `json:"last_start,omitempty"`
+	LastFinish  *time.Time `json:"last_finish,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	// ConsecutiveFailures is reset by a successful execution
+	ConsecutiveFailures int `json:"consecutive_failures"`
+	// NodeID and RunID identify the node and the run of the last finished execution
+	NodeID string `json:"node_id,omitempty"`
+	RunID  string `json:"run_id,omitempty"`
+}
@@ -1,19 +1,97 @@
 package models
 
-import "time"
+import (
+	"context"
+	"fmt"
+	"time"
+)
 
 type TickerType int
 
 const (
 	TickerInterval TickerType = 0
 	TickerTime     TickerType = 1
+	TickerCron     TickerType = 2
 )
 
+func (t TickerType) String() string {
+	switch t {
+	case TickerInterval:
+		return "interval"
+	case TickerTime:
+		return "time"
+	case TickerCron:
+		return "cron"
+	}
+	return fmt.Sprintf("TickerType(%d)", int(t))
+}
+
 type Task struct {
 	Name    string
-	Handler func()
+	Handler func(ctx context.Context) error
 
 	TickerType           TickerType
 	Interval             time.Duration
 	Hour, Minute, Second int
+	Cron                 *CronSchedule
+	// Location is used to evaluate daily and cron schedules
+	Location *time.Location
+	// Retry is applied to failed executions, nil means a single attempt
+	Retry *RetryPolicy
+	// Timeout bounds a single execution, zero means no limit
+	Timeout time.Duration
+}
+
+// TaskHandle controls a task started in the background
+type TaskHandle interface {
+	Name() string
+	// Stop stops the task, a running handler is cancelled
+	Stop()
+	// Done is closed when the task has ended
+	Done() <-chan struct{}
+	// Wait blocks until the task has ended
+	Wait()
+	// Pause skips scheduled runs until the task is resumed, a running handler is not affected
+	Pause()
+	Resume()
+	// Remove stops the task and deletes it from the scheduler, so its name can be registered again
+	Remove()
+	// TriggerNow runs the task on this node as soon as possible regardless of its schedule,
+	// the run still takes the task lock, so it does not overlap with runs on other nodes
+	TriggerNow()
+}
+
+// TaskInfo describes a task started on the scheduler
+type TaskInfo struct {
+	Name       string
+	TickerType TickerType
+	// Schedule describes the schedule of the task, e.g. "every 10s"
+	Schedule string
+	// NextRun is the next planned fire time at which the task is due according to its schedule,
+	// zero if it is not known yet
+	NextRun time.Time
+	// LastActionTime is the time of the last successful execution on any node, nil if there is none
+	LastActionTime *time.Time
+	// LockHolder is the id of the current lock holder reported by the backend, empty if the task is not locked
+	// or the backend does not implement backend.LockInspector
+	LockHolder string
+	// Running reports whether the handler is running on this node
+	Running bool
+	// Paused reports whether the task is paused on this node or cluster-wide
+	Paused bool
+}
+
+type Outcome string
+
+const (
+	OutcomeSucceeded Outcome = "succeeded"
+	OutcomeFailed    Outcome = "failed"
+	OutcomeTimedOut  Outcome = "timed_out"
+)
+
+// Failure describes the last failed execution of a task
+type Failure struct {
+	Time    time.Time `json:"time"`
+	Outcome Outcome   `json:"outcome"`
+	Error   string    `json:"error"`
 }
@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// ParseTime parses a time of day in "HH:MM" or "HH:MM:SS" format
 func ParseTime(timeStr string) (int, int, int, error) {
-	parts := strings.Split(timeStr, "-")
+	parts := strings.Split(timeStr, ":")
 
 	if len(parts) != 2 && len(parts) != 3 {
 		return 0, 0, 0, fmt.Errorf("failed to parse time, possible wrong separator")
@@ -22,27 +24,94 @@ func ParseTime(timeStr string) (int, int, int, error) {
 	if err != nil {
 		return 0, 0, 0, fmt.Errorf("failed to parse hours: %w", err)
 	}
-	if hour > 24 || hour < 0 {
-		return 0, 0, 0, fmt.Errorf("wrong hour value %v, should be => 0 and <= 24", hour)
+	if hour > 23 || hour < 0 {
+		return 0, 0, 0, fmt.Errorf("wrong hour value %v, should be >= 0 and <= 23", hour)
 	}
 
 	minute, err = strconv.ParseInt(parts[1], 10, 64)
 	if err != nil {
 		return 0, 0, 0, fmt.Errorf("failed to parse minutes: %w", err)
 	}
-	if minute > 60 || minute < 0 {
-		return 0, 0, 0, fmt.Errorf("wrong minute value %v, should be => 0 and <= 60", minute)
+	if minute > 59 || minute < 0 {
+		return 0, 0, 0, fmt.Errorf("wrong minute value %v, should be >= 0 and <= 59", minute)
 	}
 
 	if len(parts) == 3 {
 		second, err = strconv.ParseInt(parts[2], 10, 64)
 		if err != nil {
-			return 0, 0, 0, fmt.Errorf("failed to parse minutes: %w", err)
+			return 0, 0, 0, fmt.Errorf("failed to parse seconds: %w", err)
 		}
-		if second > 60 || second < 0 {
-			return 0, 0, 0, fmt.Errorf("wrong second value %v, should be => 0 and <= 60", second)
+		if second > 59 || second < 0 {
+			return 0, 0, 0, fmt.Errorf("wrong second value %v, should be >= 0 and <= 59", second)
 		}
 	}
 
 	return int(hour), int(minute), int(second), nil
 }
+
+// NextTime returns the first moment strictly after the given time when the wall clock
+// in the location of the given time shows hour:minute:second
+func NextTime(after time.Time, hour, minute, second int) time.Time {
+	year, month, day := after.Date()
+
+	// the first day is not enough when the time has passed, the second one may be shifted by DST
+	for i := 0; ; i++ {
+		if out := Date(year, month, day+i, hour, minute, second, after.Location()); out.After(after) {
+			return out
+		}
+	}
+}
+
+// Date works like time.Date, but resolves wall clock times around DST transitions deterministically:
+// a time skipped by a forward transition resolves to the moment of the transition,
+// a time repeated by a backward transition resolves to its first occurrence.
+func Date(year int, month time.Month, day, hour, minute, second int, loc *time.Location) time.Time {
+	wall := time.Date(year, month, day, hour, minute, second, 0, time.UTC)
+
+	// offsets in effect a day before and a day after cover any transition around the wall time
+	_, before := wall.Add(-24 * time.Hour).In(loc).Zone()
+	_, after := wall.Add(24 * time.Hour).In(loc).Zone()
+
+	var (
+		out   time.Time
+		found bool
+	)
+	for _, offset := range []int{before, after} {
+		candidate := wall.Add(-time.Duration(offset) * time.Second).In(loc)
+		if !isSameWallClock(candidate, wall) {
+			continue
+		}
+		if !found || candidate.Before(out) {
+			out, found = candidate, true
+		}
+	}
+
+	switch {
+	case found:
+		return out
+	case after > before:
+		return transition(wall.Add(-time.Duration(after)*time.Second), wall.Add(-time.Duration(before)*time.Second), loc)
+	default:
+		return time.Date(year, month, day, hour, minute, second, 0, loc)
+	}
+}
+
+// transition finds the first moment in (from, to] having the zone offset of to
+func transition(from, to time.Time, loc *time.Location) time.Time {
+	_, target := to.In(loc).Zone()
+
+	for to.Sub(from) > time.Second {
+		mid := from.Add(to.Sub(from) / 2).Truncate(time.Second)
+		if _, offset := mid.In(loc).Zone(); offset == target {
+			to = mid
+		} else {
+			from = mid
+		}
+	}
+	return to.In(loc)
+}
+
+func isSameWallClock(t time.Time, wall time.Time) bool {
+	return t.Year() == wall.Year() && t.YearDay() == wall.YearDay() &&
+		t.Hour() == wall.Hour() && t.Minute() == wall.Minute() && t.Second() == wall.Second()
+}
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("failed to load location %s: %v", name, err)
+	}
+	return loc
+}
+
+func TestParseTime(t *testing.T) {
+	cases := []struct {
+		Name                 string
+		Input                string
+		Hour, Minute, Second int
+		IsValid              bool
+	}{
+		{Name: "#1 hours and minutes", Input: "09:30", Hour: 9, Minute: 30, IsValid: true},
+		{Name: "#2 with seconds", Input: "22:15:30", Hour: 22, Minute: 15, Second: 30, IsValid: true},
+		{Name: "#3 midnight", Input: "00:00:00", IsValid: true},
+		{Name: "#4 last second of the day", Input: "23:59:59", Hour: 23, Minute: 59, Second: 59, IsValid: true},
+		{Name: "#5 wrong separator", Input: "22-15-30", IsValid: false},
+		{Name: "#6 hour 24", Input: "24:00", IsValid: false},
+		{Name: "#7 minute 60", Input: "12:60", IsValid: false},
+		{Name: "#8 second 60", Input: "12:00:60", IsValid: false},
+		{Name: "#9 negative", Input: "-1:00", IsValid: false},
+		{Name: "#10 not a number", Input: "aa:bb", IsValid: false},
+		{Name: "#11 too many parts", Input: "12:00:00:00", IsValid: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			hour, minute, second, err := ParseTime(c.Input)
+			if !c.IsValid {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.Hour, hour)
+			assert.Equal(t, c.Minute, minute)
+			assert.Equal(t, c.Second, second)
+		})
+	}
+}
+
+func TestDate(t *testing.T) {
+	newYork := mustLoadLocation(t, "America/New_York")
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+
+	cases := []struct {
+		Name                 string
+		Location             *time.Location
+		Year                 int
+		Month                time.Month
+		Day                  int
+		Hour, Minute, Second int
+
+		Expect time.Time
+	}{
+		{
+			Name:     "#1 regular time",
+			Location: newYork,
+			Year:     2021, Month: time.June, Day: 1, Hour: 9, Minute: 30,
+			Expect: time.Date(2021, time.June, 1, 13, 30, 0, 0, time.UTC),
+		},
+		{
+			Name:     "#2 skipped hour in New York resolves to the transition",
+			Location: newYork,
+			Year:     2021, Month: time.March, Day: 14, Hour: 2, Minute: 30,
+			Expect: time.Date(2021, time.March, 14, 7, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:     "#3 skipped hour in Berlin resolves to the transition",
+			Location: berlin,
+			Year:     2021, Month: time.March, Day: 28, Hour: 2, Minute: 30,
+			Expect: time.Date(2021, time.March, 28, 1, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:     "#4 repeated hour in New York resolves to the first occurrence",
+			Location: newYork,
+			Year:     2021, Month: time.November, Day: 7, Hour: 1, Minute: 30,
+			Expect: time.Date(2021, time.November, 7, 5, 30, 0, 0, time.UTC),
+		},
+		{
+			Name:     "#5 repeated hour in Berlin resolves to the first occurrence",
+			Location: berlin,
+			Year:     2021, Month: time.October, Day: 31, Hour: 2, Minute: 30,
+			Expect: time.Date(2021, time.October, 31, 0, 30, 0, 0, time.UTC),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			out := Date(c.Year, c.Month, c.Day, c.Hour, c.Minute, c.Second, c.Location)
+			assert.True(t, c.Expect.Equal(out), "expected %v, got %v", c.Expect, out.UTC())
+			assert.Equal(t, c.Location, out.Location())
+		})
+	}
+}
+
+func TestNextTime(t *testing.T) {
+	newYork := mustLoadLocation(t, "America/New_York")
+
+	cases := []struct {
+		Name                 string
+		After                time.Time
+		Hour, Minute, Second int
+
+		Expect time.Time
+	}{
+		{
+			Name:   "#1 later today",
+			After:  time.Date(2021, time.June, 1, 8, 0, 0, 0, newYork),
+			Hour:   9,
+			Minute: 30,
+			Expect: time.Date(2021, time.June, 1, 9, 30, 0, 0, newYork),
+		},
+		{
+			Name:   "#2 passed today",
+			After:  time.Date(2021, time.June, 1, 9, 30, 0, 0, newYork),
+			Hour:   9,
+			Minute: 30,
+			Expect: time.Date(2021, time.June, 2, 9, 30, 0, 0, newYork),
+		},
+		{
+			Name:   "#3 skipped hour",
+			After:  time.Date(2021, time.March, 13, 2, 30, 0, 0, newYork),
+			Hour:   2,
+			Minute: 30,
+			Expect: time.Date(2021, time.March, 14, 7, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:   "#4 day after the skipped hour",
+			After:  time.Date(2021, time.March, 14, 7, 0, 0, 0, time.UTC).In(newYork),
+			Hour:   2,
+			Minute: 30,
+			Expect: time.Date(2021, time.March, 15, 2, 30, 0, 0, newYork),
+		},
+		{
+			Name:   "#5 repeated hour runs once",
+			After:  time.Date(2021, time.November, 7, 5, 30, 0, 0, time.UTC).In(newYork),
+			Hour:   1,
+			Minute: 30,
+			Expect: time.Date(2021, time.November, 8, 1, 30, 0, 0, newYork),
+		},
+		{
+			Name:   "#6 day is 24 hours in local time, not in UTC",
+			After:  time.Date(2021, time.November, 6, 12, 0, 0, 0, newYork),
+			Hour:   12,
+			Minute: 0,
+			Expect: time.Date(2021, time.November, 7, 17, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			out := NextTime(c.After, c.Hour, c.Minute, c.Second)
+			assert.True(t, c.Expect.Equal(out), "expected %v, got %v", c.Expect, out)
+		})
+	}
+}
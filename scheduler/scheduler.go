@@ -2,17 +2,25 @@ package scheduler
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/tls"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/skvoch/reter/scheduler/logger"
 	etcd "go.etcd.io/etcd/client/v3"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 
-	"github.com/skvoch/go-etcd-lock/v5/lock"
+	"github.com/skvoch/reter/scheduler/backend"
+	"github.com/skvoch/reter/scheduler/backend/etcdbackend"
 	"github.com/skvoch/reter/scheduler/builder"
 	"github.com/skvoch/reter/scheduler/models"
 )
@@ -20,59 +28,239 @@ import (
 var (
 	ErrNotUniqueTaskName = errors.New("not unique task name")
 	ErrNilHandler        = errors.New("handler func is nil")
+	ErrHandlerTimeout    = errors.New("handler has timed out")
+	ErrHandlerPanic      = errors.New("handler has panicked")
+	ErrSchedulerClosed   = errors.New("scheduler is closed")
+	ErrShutdownTimeout   = errors.New("tasks have not finished in time")
+	ErrTaskNotFound      = errors.New("task not found")
+	ErrInvalidSchedule   = errors.New("invalid schedule")
+
+	ErrNotUniqueHandlerName    = errors.New("not unique handler name")
+	ErrHandlerNotFound         = errors.New("handler not found")
+	ErrInvalidDefinition       = errors.New("invalid task definition")
+	ErrDefinitionsNotSupported = errors.New("backend does not support task definitions")
+	ErrHistoryNotSupported     = errors.New("backend does not support execution history")
+)
+
+const (
+	defaultMaxClockSkew    = time.Second
+	defaultHistoryMaxCount = 100
+	// maxTickJitter bounds how much earlier than a full interval after the last action an interval task is due
+	maxTickJitter = time.Second
 )
 
+// defaultTimeRetryPolicy retries the backend errors of daily tasks without a policy, since a missed run
+// is not repeated until the next day. Handler errors are retried only with a policy set by Builder.Retry.
+var defaultTimeRetryPolicy = models.RetryPolicy{
+	InitialInterval: time.Second * 3,
+	Multiplier:      1,
+	MaxElapsedTime:  time.Hour,
+}
+
 type EtcdOptions struct {
+	// Client is an already configured client of the application, it is used instead of creating a new one
+	// and is not closed by the scheduler. All other etcd options and TLS are ignored if it is set.
+	Client *etcd.Client
+
 	Endpoints   []string
 	LogWarnings bool
+
+	Username string
+	Password string
+
+	// AutoSyncInterval is the interval of updating endpoints with the cluster members, zero disables it
+	AutoSyncInterval     time.Duration
+	DialTimeout          time.Duration
+	DialKeepAliveTime    time.Duration
+	DialKeepAliveTimeout time.Duration
+	// PermitWithoutStream allows keepalive pings without active streams
+	PermitWithoutStream bool
+	// RejectOldCluster refuses to connect to an outdated cluster
+	RejectOldCluster   bool
+	MaxCallSendMsgSize int
+	MaxCallRecvMsgSize int
+
+	// DialOptions are passed to the grpc client, e.g. interceptors
+	DialOptions []grpc.DialOption
+	// Logger replaces the client logger, LogWarnings is ignored if it is set
+	Logger *zap.Logger
+	// Context is the default client context, cancelling it cancels the dial and the requests of the client
+	Context context.Context
 }
 
 type Options struct {
-	Etcd    EtcdOptions
+	// Backend replaces etcd with another storage for locks and execution state, e.g. redisbackend,
+	// Etcd, KeyPrefix and TLS options are ignored if it is set
+	Backend backend.Backend
+
+	Etcd EtcdOptions
+	// KeyPrefix puts all etcd keys under "<prefix>/tasks/<name>/" and "<prefix>/locks/<name>",
+	// e.g. "/reter/billing/production" keeps services and environments sharing a cluster apart.
+	// Without it the keys of older versions are used: the bare task name and "<name>/lock".
+	// Existing state is moved to the prefixed layout with etcdbackend.Backend.MigrateKeys.
+	KeyPrefix string
+
 	LockTTL time.Duration
 	Timeout time.Duration
-	TLS *tls.Config
+	TLS     *tls.Config
+	// OnLockLost is called when the lock lease of a running task can not be kept alive,
+	// the handler context is cancelled right after that
+	OnLockLost func(taskName string)
+	// OnPanic is called when a task handler panics, the panic is recovered and the run is recorded as failed
+	OnPanic func(taskName string, recovered interface{}, stack []byte)
+	// DefaultLocation is used for daily and cron tasks without explicit location,
+	// if it is nil the local time zone of the host is used
+	DefaultLocation *time.Location
+	// ServerTime makes due-ness decisions and stored timestamps use the clock of the backend server
+	// instead of the local one, so skewed node clocks do not cause double runs or gaps.
+	// The backend has to implement backend.Clock (redis, postgres). It is a no-op with etcd, which has no time API:
+	// only a warning is logged on start and the clocks of the nodes still have to be kept in sync.
+	ServerTime bool
+	// MaxClockSkew is the difference between clocks which is tolerated without a warning in the log, 1s if it is zero
+	MaxClockSkew time.Duration
+
+	// NodeID identifies the node in the execution history, the host name is used if it is empty
+	NodeID string
+	// History records every execution in the backend, nil disables it. The latest 100 executions of a task
+	// are kept if the retention is empty. The backend has to implement backend.HistoryStore (etcd, memory, redis).
+	History *models.Retention
 }
 
 type Scheduler interface {
 	Every(count ...uint) *builder.Builder
+	Cron(expr string) *builder.Do
+	// Shutdown stops accepting new tasks and stops all task watchers, running handlers are waited for
+	// until ctx is done. Handlers which have not finished by then are cancelled, their locks are released
+	// and ErrShutdownTimeout listing their tasks is returned. The etcd client created by New is closed.
+	Shutdown(ctx context.Context) error
+	// Wait blocks until all tasks started on the scheduler have ended
+	Wait()
+
+	// Pause, Resume, Remove and TriggerNow control a task by name like models.TaskHandle does,
+	// ErrTaskNotFound is returned if there is no such task
+	Pause(name string) error
+	Resume(name string) error
+	Remove(name string) error
+	TriggerNow(name string) error
+	// Reschedule replaces the schedule of a running task, e.g. one built with Every().Interval(d).Schedule().
+	// It is applied after a running execution has finished, the last action time is kept,
+	// so the task runs once its new schedule is due. The retry policy set by Builder.Retry is kept,
+	// the default retry of daily tasks follows the new schedule.
+	Reschedule(name string, schedule models.Schedule) error
+	// Tasks describes the tasks started on the scheduler sorted by name, the last action times
+	// and lock holders are read from the backend
+	Tasks(ctx context.Context) ([]models.TaskInfo, error)
+	// History returns up to limit latest executions of the task on all nodes, the newest first,
+	// all of the kept ones if limit is not positive
+	History(ctx context.Context, name string, limit int) ([]models.Execution, error)
+
+	// RegisterHandler makes the handler available to task definitions under the given name,
+	// handlers should be registered before watching the definitions
+	RegisterHandler(name string, handler models.HandlerFunc) error
+	// WatchDefinitions runs the tasks defined in the backend and keeps them in sync with the definitions
+	// until ctx is done or the scheduler is shut down, then the defined tasks are stopped and waited for.
+	// ErrDefinitionsNotSupported is returned if the backend does not implement backend.DefinitionSource.
+	WatchDefinitions(ctx context.Context) error
 }
 
 func New(logger logger.Logger, opts *Options) (Scheduler, error) {
+	if opts.Backend != nil {
+		return NewWithBackend(logger, opts.Backend, opts), nil
+	}
+
+	if opts.Etcd.Client != nil {
+		return NewWithBackend(logger, etcdbackend.New(opts.Etcd.Client, opts.KeyPrefix), opts), nil
+	}
+
+	client, err := etcd.New(etcdConfig(opts))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create etcd client: %w", err)
+	}
+
+	out := NewWithBackend(logger, etcdbackend.New(client, opts.KeyPrefix), opts).(*impl)
+	out.closeClient = client.Close
+	return out, nil
+}
+
+func etcdConfig(opts *Options) etcd.Config {
 	zapConfig := zap.NewProductionConfig()
 	zapConfig.Level.SetLevel(zap.ErrorLevel)
 	if opts.Etcd.LogWarnings {
 		zapConfig.Level.SetLevel(zap.WarnLevel)
 	}
 
-	client, err := etcd.New(etcd.Config{
-		Endpoints: opts.Etcd.Endpoints,
-		LogConfig: &zapConfig,
-		TLS: opts.TLS,
-	})
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to create etcd client: %w", err)
+	config := etcd.Config{
+		Endpoints:            opts.Etcd.Endpoints,
+		AutoSyncInterval:     opts.Etcd.AutoSyncInterval,
+		DialTimeout:          opts.Etcd.DialTimeout,
+		DialKeepAliveTime:    opts.Etcd.DialKeepAliveTime,
+		DialKeepAliveTimeout: opts.Etcd.DialKeepAliveTimeout,
+		MaxCallSendMsgSize:   opts.Etcd.MaxCallSendMsgSize,
+		MaxCallRecvMsgSize:   opts.Etcd.MaxCallRecvMsgSize,
+		TLS:                  opts.TLS,
+		Username:             opts.Etcd.Username,
+		Password:             opts.Etcd.Password,
+		RejectOldCluster:     opts.Etcd.RejectOldCluster,
+		PermitWithoutStream:  opts.Etcd.PermitWithoutStream,
+		DialOptions:          opts.Etcd.DialOptions,
+		Context:              opts.Etcd.Context,
+		LogConfig:            &zapConfig,
+	}
+	if opts.Etcd.Logger != nil {
+		config.Logger = opts.Etcd.Logger
+		config.LogConfig = nil
 	}
+	return config
+}
 
-	return &impl{
+// NewWithBackend creates a scheduler which coordinates task executions through the given backend
+func NewWithBackend(logger logger.Logger, backend backend.Backend, opts *Options) Scheduler {
+	out := &impl{
 		opts:    opts,
-		tasks:   make(map[string]interface{}),
+		tasks:   make(map[string]*taskEntry),
 		logger:  logger,
 		tasksMx: &sync.Mutex{},
-		etcd:    client,
-		locker:  lock.NewEtcdLocker(client, lock.WithMaxTryLockTimeout(opts.Timeout)),
-	}, nil
+		backend: backend,
+		stop:    make(chan struct{}),
+		kill:    make(chan struct{}),
+
+		clusterPaused:   make(map[string]bool),
+		handlers:        make(map[string]models.HandlerFunc),
+		stopControlling: func() {},
+	}
+
+	out.nodeID = nodeID(opts)
+	out.checkServerTime()
+	out.checkHistory()
+	return out
 }
 
 type impl struct {
 	tasksMx *sync.Mutex
-	tasks   map[string]interface{}
+	tasks   map[string]*taskEntry
 	opts    *Options
 
-	locker lock.Locker
-	logger logger.Logger
-	etcd   *etcd.Client
+	logger  logger.Logger
+	backend backend.Backend
+	nodeID  string
+	// closeClient closes the etcd client created by New, clients passed by the application are not closed
+	closeClient func() error
+
+	// stop is closed on shutdown to stop the watchers, kill is closed when running handlers have to be cancelled
+	stop      chan struct{}
+	kill      chan struct{}
+	killOnce  sync.Once
+	closeOnce sync.Once
+
+	// clusterPaused holds the tasks paused on all nodes through the backend control keys
+	clusterPausedMx sync.Mutex
+	clusterPaused   map[string]bool
+	controlOnce     sync.Once
+	stopControlling context.CancelFunc
+
+	// handlers are the handlers registered for task definitions
+	handlersMx sync.Mutex
+	handlers   map[string]models.HandlerFunc
 }
 
 func (i *impl) Every(inputCount ...uint) *builder.Builder {
@@ -85,30 +273,342 @@ func (i *impl) Every(inputCount ...uint) *builder.Builder {
 	return builder.New(i, count)
 }
 
+func (i *impl) Cron(expr string) *builder.Do {
+	return builder.New(i, 0).Cron(expr)
+}
+
 func (i *impl) Run(ctx context.Context, task models.Task) error {
+	handle, err := i.Start(ctx, task)
+	if err != nil {
+		return err
+	}
+
+	handle.Wait()
+	return nil
+}
+
+func (i *impl) Start(ctx context.Context, task models.Task) (models.TaskHandle, error) {
 	if err := i.validateTask(task); err != nil {
-		return fmt.Errorf("failed to validate task: %w", err)
+		return nil, fmt.Errorf("failed to validate task: %w", err)
 	}
 
-	i.setTask(task.Name)
+	if task.Location == nil {
+		task.Location = i.defaultLocation()
+	}
 
-	switch task.TickerType {
-	case models.TickerInterval:
-		i.watcherInterval(ctx, task)
-	case models.TickerTime:
-		i.watcherTime(ctx, task)
+	ctx, cancel := context.WithCancel(ctx)
+	entry, err := i.setTask(task.Name, cancel)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to run task: %w", err)
+	}
+
+	go i.watch(ctx, task, entry)
+	go i.claimTrigger(ctx, entry)
+	return entry, nil
+}
+
+func (i *impl) Wait() {
+	for {
+		entries := i.taskEntries()
+
+		running := false
+		for _, entry := range entries {
+			select {
+			case <-entry.done:
+			default:
+				running = true
+				<-entry.done
+			}
+		}
+
+		// tasks may have been started while waiting for the others
+		if !running {
+			return
+		}
+	}
+}
+
+// watch runs the watcher of the task until the task is stopped
+func (i *impl) watch(ctx context.Context, task models.Task, entry *taskEntry) {
+	defer close(entry.done)
+	defer entry.cancel()
+	// the name is released once the task has ended, so it can be registered again
+	defer i.removeTask(entry)
+
+	ctx = withTaskEntry(ctx, entry)
+
+	// the handlers are cancelled on shutdown only if they have not finished in time
+	go func() {
+		select {
+		case <-i.kill:
+			entry.cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		entry.setSchedule(task.Schedule())
+
+		var rescheduled bool
+		switch task.TickerType {
+		case models.TickerInterval:
+			rescheduled = i.watcherInterval(ctx, task, entry)
+		case models.TickerTime:
+			rescheduled = i.watcherTime(ctx, task, entry)
+		case models.TickerCron:
+			rescheduled = i.watcherCron(ctx, task, entry)
+		}
+		if !rescheduled {
+			return
+		}
+
+		task.SetSchedule(entry.takeSchedule())
+		i.logger.Log(ctx, logger.LogLevelInfo, "task has been rescheduled", map[string]interface{}{"task_name": task.Name})
+	}
+}
+
+// tick runs the execution on a watcher tick, scheduled runs of a paused task are skipped
+func (i *impl) tick(ctx context.Context, task models.Task, entry *taskEntry) {
+	if entry.isPaused() && !isTriggered(ctx) {
+		i.logger.Log(ctx, logger.LogLevelDebug, "task is paused", map[string]interface{}{"task_name": task.Name})
+		return
+	}
+
+	if err := i.execute(ctx, task); err != nil {
+		i.logger.Log(ctx, logger.LogLevelError, "trying to run handler function", map[string]interface{}{"error": err})
+	}
+}
+
+func (i *impl) defaultLocation() *time.Location {
+	if i.opts.DefaultLocation != nil {
+		return i.opts.DefaultLocation
+	}
+	return time.Local
+}
+
+func (i *impl) setTask(name string, cancel context.CancelFunc) (*taskEntry, error) {
+	i.tasksMx.Lock()
+	defer i.tasksMx.Unlock()
+
+	select {
+	case <-i.stop:
+		return nil, ErrSchedulerClosed
 	default:
-		return fmt.Errorf("failed to run task: unknown ticker type %v", task.TickerType)
 	}
 
+	// the control commands are watched once the first task has been started
+	i.controlOnce.Do(i.watchControl)
+
+	entry := newTaskEntry(name, cancel)
+	entry.remove = func() {
+		i.removeTask(entry)
+	}
+	i.tasks[name] = entry
+	return entry, nil
+}
+
+// removeTask deletes the entry unless the name has been registered again
+func (i *impl) removeTask(entry *taskEntry) {
+	i.tasksMx.Lock()
+	defer i.tasksMx.Unlock()
+
+	if i.tasks[entry.name] == entry {
+		delete(i.tasks, entry.name)
+	}
+}
+
+func (i *impl) task(name string) (*taskEntry, error) {
+	i.tasksMx.Lock()
+	defer i.tasksMx.Unlock()
+
+	entry, ok := i.tasks[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTaskNotFound, name)
+	}
+	return entry, nil
+}
+
+func (i *impl) Pause(name string) error {
+	entry, err := i.task(name)
+	if err != nil {
+		return err
+	}
+
+	entry.Pause()
+	return nil
+}
+
+func (i *impl) Resume(name string) error {
+	entry, err := i.task(name)
+	if err != nil {
+		return err
+	}
+
+	entry.Resume()
+	return nil
+}
+
+func (i *impl) Remove(name string) error {
+	entry, err := i.task(name)
+	if err != nil {
+		return err
+	}
+
+	entry.Remove()
+	return nil
+}
+
+func (i *impl) TriggerNow(name string) error {
+	entry, err := i.task(name)
+	if err != nil {
+		return err
+	}
+
+	entry.TriggerNow()
+	return nil
+}
+
+func (i *impl) Reschedule(name string, schedule models.Schedule) error {
+	if err := validateSchedule(schedule); err != nil {
+		return fmt.Errorf("failed to validate schedule: %w", err)
+	}
+
+	entry, err := i.task(name)
+	if err != nil {
+		return err
+	}
+
+	if schedule.Location == nil {
+		schedule.Location = i.defaultLocation()
+	}
+	entry.reschedule(schedule)
 	return nil
 }
 
-func (i *impl) setTask(name string) {
+func (i *impl) Tasks(ctx context.Context) ([]models.TaskInfo, error) {
+	entries := i.taskEntries()
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].name < entries[b].name
+	})
+
+	inspector, canInspect := i.backend.(backend.LockInspector)
+
+	out := make([]models.TaskInfo, 0, len(entries))
+	for _, entry := range entries {
+		schedule, next := entry.plan()
+
+		lastActionTime, err := i.getLastActionTime(ctx, entry.name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get last action time of %s: %w", entry.name, err)
+		}
+
+		info := models.TaskInfo{
+			Name:           entry.name,
+			TickerType:     schedule.TickerType,
+			Schedule:       schedule.String(),
+			NextRun:        nextRun(schedule, next, lastActionTime),
+			LastActionTime: lastActionTime,
+			Running:        entry.isRunning(),
+			Paused:         entry.isPaused() || i.isClusterPaused(entry.name),
+		}
+
+		if canInspect {
+			lockCtx, cancel := i.contextWithTimeout(ctx)
+			info.LockHolder, err = inspector.LockHolder(lockCtx, entry.name)
+			cancel()
+
+			if err != nil {
+				return nil, fmt.Errorf("failed to get lock holder of %s: %w", entry.name, err)
+			}
+		}
+
+		out = append(out, info)
+	}
+	return out, nil
+}
+
+// nextRun skips the interval ticks at which the task is not due yet, e.g. since it has been run on another node,
+// the timers of daily and cron tasks are set to the next slot already
+func nextRun(schedule models.Schedule, next time.Time, lastActionTime *time.Time) time.Time {
+	if schedule.TickerType != models.TickerInterval || next.IsZero() || lastActionTime == nil {
+		return next
+	}
+
+	due := lastActionTime.Add(schedule.Interval)
+	if next.Before(due) {
+		skipped := (due.Sub(next) + schedule.Interval - 1) / schedule.Interval
+		next = next.Add(skipped * schedule.Interval)
+	}
+	return next
+}
+
+func (i *impl) taskEntries() []*taskEntry {
 	i.tasksMx.Lock()
 	defer i.tasksMx.Unlock()
 
-	i.tasks[name] = struct{}{}
+	out := make([]*taskEntry, 0, len(i.tasks))
+	for _, entry := range i.tasks {
+		out = append(out, entry)
+	}
+	return out
+}
+
+func (i *impl) Shutdown(ctx context.Context) error {
+	i.tasksMx.Lock()
+	select {
+	case <-i.stop:
+	default:
+		close(i.stop)
+	}
+	i.stopControlling()
+	i.tasksMx.Unlock()
+
+	entries := i.taskEntries()
+
+	var unfinished []string
+	for _, entry := range entries {
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			select {
+			case <-entry.done:
+			default:
+				unfinished = append(unfinished, entry.name)
+			}
+		}
+	}
+
+	if len(unfinished) != 0 {
+		i.killOnce.Do(func() {
+			close(i.kill)
+		})
+
+		// the locks are released right away, so other nodes do not wait for the cancelled handlers
+		for _, entry := range entries {
+			if l := entry.takeLock(); l != nil {
+				if err := i.release(l); err != nil {
+					i.logger.Log(ctx, logger.LogLevelError, "failed to release locker on shutdown", map[string]interface{}{"task_name": entry.name, "error": err})
+				}
+			}
+		}
+	}
+
+	var err error
+	i.closeOnce.Do(func() {
+		if i.closeClient != nil {
+			err = i.closeClient()
+		}
+	})
+
+	if len(unfinished) != 0 {
+		sort.Strings(unfinished)
+		return fmt.Errorf("%w: %s", ErrShutdownTimeout, strings.Join(unfinished, ", "))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to close etcd client: %w", err)
+	}
+	return nil
 }
 
 func (i *impl) validateTask(task models.Task) error {
@@ -116,6 +616,10 @@ func (i *impl) validateTask(task models.Task) error {
 		return ErrNilHandler
 	}
 
+	if err := validateSchedule(task.Schedule()); err != nil {
+		return err
+	}
+
 	i.tasksMx.Lock()
 	defer i.tasksMx.Unlock()
 
@@ -126,65 +630,174 @@ func (i *impl) validateTask(task models.Task) error {
 	return nil
 }
 
-func (i *impl) watcherInterval(ctx context.Context, task models.Task) {
+func validateSchedule(schedule models.Schedule) error {
+	switch schedule.TickerType {
+	case models.TickerInterval:
+		if schedule.Interval <= 0 {
+			return fmt.Errorf("%w: interval should be > 0, got %s", ErrInvalidSchedule, schedule.Interval)
+		}
+	case models.TickerTime:
+		if schedule.Hour < 0 || schedule.Hour > 23 || schedule.Minute < 0 || schedule.Minute > 59 || schedule.Second < 0 || schedule.Second > 59 {
+			return fmt.Errorf("%w: invalid time of day %02d:%02d:%02d", ErrInvalidSchedule, schedule.Hour, schedule.Minute, schedule.Second)
+		}
+	case models.TickerCron:
+		if schedule.Cron == nil {
+			return fmt.Errorf("%w: cron schedule is nil", ErrInvalidSchedule)
+		}
+	default:
+		return fmt.Errorf("%w: unknown ticker type %v", ErrInvalidSchedule, schedule.TickerType)
+	}
+	return nil
+}
+
+// watcherInterval, watcherTime and watcherCron run the task until it is stopped,
+// true is returned if they have stopped since the schedule has been changed
+func (i *impl) watcherInterval(ctx context.Context, task models.Task, entry *taskEntry) bool {
 	i.logger.Log(ctx, logger.LogLevelInfo, "running task", map[string]interface{}{"task_name": task.Name})
 	ticker := time.NewTicker(task.Interval)
+	entry.setNext(time.Now().Add(task.Interval))
 
 	for {
 		select {
 		case <-ctx.Done():
 			ticker.Stop()
 			i.logger.Log(ctx, logger.LogLevelInfo, "task has been finished", map[string]interface{}{"task_name": task.Name})
-			return
+			return false
 
-		case <-ticker.C:
-			if err := i.handler(ctx, task); err != nil {
-				i.logger.Log(ctx, logger.LogLevelError, "trying to run handler function", map[string]interface{}{"error": err})
-			}
+		case <-i.stop:
+			ticker.Stop()
+			i.logger.Log(ctx, logger.LogLevelInfo, "task has been stopped", map[string]interface{}{"task_name": task.Name})
+			return false
+
+		case <-entry.rescheduled:
+			ticker.Stop()
+			return true
+
+		case <-entry.trigger:
+			i.tick(withTriggered(ctx), task, entry)
+
+		case now := <-ticker.C:
+			entry.setNext(now.Add(task.Interval))
+			i.tick(ctx, task, entry)
+		}
+	}
+}
+
+func (i *impl) watcherTime(ctx context.Context, task models.Task, entry *taskEntry) bool {
+	i.logger.Log(ctx, logger.LogLevelInfo, "running task", map[string]interface{}{"task_name": task.Name})
+
+	for {
+		target := models.NextTime(time.Now().In(task.Location), task.Hour, task.Minute, task.Second)
+		timer := time.NewTimer(time.Until(target))
+		entry.setNext(target)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			i.logger.Log(ctx, logger.LogLevelInfo, "task has been finished", map[string]interface{}{"task_name": task.Name})
+			return false
+
+		case <-i.stop:
+			timer.Stop()
+			i.logger.Log(ctx, logger.LogLevelInfo, "task has been stopped", map[string]interface{}{"task_name": task.Name})
+			return false
+
+		case <-entry.rescheduled:
+			timer.Stop()
+			return true
+
+		case <-entry.trigger:
+			timer.Stop()
+			i.tick(withTriggered(ctx), task, entry)
+
+		case <-timer.C:
+			i.tick(ctx, task, entry)
 		}
 	}
 }
 
-func (i *impl) watcherTime(ctx context.Context, task models.Task) {
+func (i *impl) watcherCron(ctx context.Context, task models.Task, entry *taskEntry) bool {
 	i.logger.Log(ctx, logger.LogLevelInfo, "running task", map[string]interface{}{"task_name": task.Name})
 
-MainLoop:
 	for {
-		now := time.Now()
-		target := time.Date(now.Year(), now.Month(), now.Day(), task.Hour, task.Minute, task.Second, 0, now.Location())
-		diff := target.Sub(now)
+		next := task.Cron.Next(time.Now().In(task.Location))
+		if next.IsZero() {
+			i.logger.Log(ctx, logger.LogLevelError, "cron expression has no next fire time", map[string]interface{}{"task_name": task.Name})
+			return false
+		}
+		timer := time.NewTimer(time.Until(next))
+		entry.setNext(next)
 
-		if diff < 0 {
-			diff = diff + (time.Hour * 24)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			i.logger.Log(ctx, logger.LogLevelInfo, "task has been finished", map[string]interface{}{"task_name": task.Name})
+			return false
+
+		case <-i.stop:
+			timer.Stop()
+			i.logger.Log(ctx, logger.LogLevelInfo, "task has been stopped", map[string]interface{}{"task_name": task.Name})
+			return false
+
+		case <-entry.rescheduled:
+			timer.Stop()
+			return true
+
+		case <-entry.trigger:
+			timer.Stop()
+			i.tick(withTriggered(ctx), task, entry)
+
+		case <-timer.C:
+			i.tick(ctx, task, entry)
 		}
-		timer := time.NewTimer(diff)
+	}
+}
 
-		for {
-			select {
-			case <-ctx.Done():
-				timer.Stop()
-				i.logger.Log(ctx, logger.LogLevelInfo, "task has been finished", map[string]interface{}{"task_name": task.Name})
-				return
-
-			case <-timer.C:
-				for {
-					select {
-					case <-ctx.Done():
-						timer.Stop()
-						i.logger.Log(ctx, logger.LogLevelInfo, "task has been finished", map[string]interface{}{"task_name": task.Name})
-						return
-
-					default:
-						if err := i.handler(ctx, task); err != nil {
-							i.logger.Log(ctx, logger.LogLevelError, "trying to run handler function", map[string]interface{}{"error": err})
-							time.Sleep(time.Second * 3)
-							continue
-						}
-						timer.Stop()
-						goto MainLoop
-					}
-				}
-			}
+// execute runs the handler applying the task retry policy to handler and backend errors,
+// daily tasks without a policy retry the backend errors only
+func (i *impl) execute(ctx context.Context, task models.Task) error {
+	// the default is picked by the current schedule, so it follows Reschedule
+	policy, backendOnly := task.Retry, false
+	if policy == nil && task.TickerType == models.TickerTime {
+		policy, backendOnly = &defaultTimeRetryPolicy, true
+	}
+	if policy == nil {
+		return i.handler(withAttempt(ctx, 1), task)
+	}
+
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := i.handler(withAttempt(ctx, attempt), task)
+		if err == nil {
+			return nil
+		}
+
+		var handlerErr *handlerError
+		if backendOnly && errors.As(err, &handlerErr) {
+			return err
+		}
+
+		delay := policy.Backoff(attempt)
+		if !policy.CanRetry(attempt, time.Since(start)+delay) {
+			return fmt.Errorf("failed after %d attempts: %w", attempt, err)
+		}
+
+		i.logger.Log(ctx, logger.LogLevelWarn, "execution has failed, retrying", map[string]interface{}{
+			"task_name": task.Name,
+			"attempt":   attempt,
+			"delay":     delay.String(),
+			"error":     err,
+		})
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-i.stop:
+			timer.Stop()
+			return err
+		case <-timer.C:
 		}
 	}
 }
@@ -192,21 +805,41 @@ MainLoop:
 func (i *impl) handler(ctx context.Context, task models.Task) error {
 	var (
 		err error
-		l   lock.Lock
+		l   backend.Lock
 	)
-	lastActionTime, err := i.getLastActionTime(i.contextWithTimeout(ctx), task.Name)
+	if !isTriggered(ctx) && i.isClusterPaused(task.Name) {
+		i.logger.Log(ctx, logger.LogLevelDebug, "task is paused cluster-wide", map[string]interface{}{"task_name": task.Name})
+		return nil
+	}
+
+	now, err := i.now(ctx)
+	if err != nil {
+		return err
+	}
+
+	lastActionTime, err := i.getLastActionTime(ctx, task.Name)
 	if err != nil {
 		return fmt.Errorf("failed to get last action time: %w", err)
 	}
 
-	if !i.isTimeSinceLastActionGreaterInterval(lastActionTime, task.Interval) {
-		i.logger.Log(ctx, logger.LogLevelDebug, "time since last action less than interval", map[string]interface{}{"task_name": task.Name})
+	// the last action time is written by any node, so it is ahead of now only if their clocks differ
+	if lastActionTime != nil {
+		i.checkClockSkew(ctx, task.Name, "last action time is ahead of the current time", lastActionTime.Sub(now))
+	}
+
+	if !isTriggered(ctx) && !i.isDue(task, lastActionTime, now) {
+		i.logger.Log(ctx, logger.LogLevelDebug, "task is not due yet", map[string]interface{}{"task_name": task.Name})
 		return nil
 	}
 
-	if l, err = i.locker.Acquire(i.contextWithTimeout(ctx), task.Name, int(i.opts.LockTTL.Seconds())); err != nil {
-		if errors.Is(err, &lock.ErrAlreadyLocked{}) {
+	if l, err = i.acquire(ctx, task.Name); err != nil {
+		if errors.Is(err, backend.ErrAlreadyLocked) {
 			i.logger.Log(ctx, logger.LogLevelDebug, "task already locked", map[string]interface{}{"task_name": task.Name})
+
+			// a triggered run is not skipped, it waits for the run holding the lock to finish
+			if entry := taskEntryFromContext(ctx); entry != nil && isTriggered(ctx) {
+				entry.retryTrigger(triggerRetryInterval)
+			}
 			return nil
 		}
 		return fmt.Errorf("failed to acquire locker: %w", err)
@@ -214,51 +847,477 @@ func (i *impl) handler(ctx context.Context, task models.Task) error {
 
 	i.logger.Log(ctx, logger.LogLevelDebug, "locker has been locked", map[string]interface{}{"task_name": task.Name})
 
-	task.Handler()
-
-	if err := i.setLastActionTime(i.contextWithTimeout(ctx), task.Name, time.Now()); err != nil {
-		return fmt.Errorf("failed to set last action time: %w", err)
+	entry := taskEntryFromContext(ctx)
+	if entry != nil {
+		entry.setLock(l)
 	}
 
-	if err := l.Release(); err != nil {
-		return fmt.Errorf("failed to release locker: %w", err)
+	err = i.runLocked(ctx, task, l)
+
+	// the lock has been released on shutdown already if the handler has not finished in time
+	if entry == nil || entry.takeLock() != nil {
+		if err := i.release(l); err != nil {
+			return fmt.Errorf("failed to release locker: %w", err)
+		}
 	}
 
 	i.logger.Log(ctx, logger.LogLevelDebug, "locker has been released", map[string]interface{}{"task_name": task.Name})
-	return nil
+	return err
 }
 
-func (i *impl) contextWithTimeout(ctx context.Context) context.Context {
-	out, _ := context.WithTimeout(ctx, i.opts.Timeout)
-	return out
+// runLocked claims the schedule slot and runs the handler while the task lock is held,
+// the slot is claimed once more since another node may have run the task after the last action time was read
+func (i *impl) runLocked(ctx context.Context, task models.Task, l backend.Lock) error {
+	start, err := i.now(ctx)
+	if err != nil {
+		return err
+	}
+	// the end of the run is measured with the local monotonic clock, so it is not fetched from the server once more
+	localStart := time.Now()
+	finished := func() time.Time {
+		return start.Add(time.Since(localStart))
+	}
+
+	unclaim, claimed, err := i.claim(ctx, task, start)
+	if err != nil {
+		return fmt.Errorf("failed to claim task: %w", err)
+	}
+	if !claimed {
+		i.logger.Log(ctx, logger.LogLevelDebug, "task has already been run by another node", map[string]interface{}{"task_name": task.Name})
+		return nil
+	}
+
+	runID, err := newRunID()
+	if err != nil {
+		return fmt.Errorf("failed to generate run id: %w", err)
+	}
+
+	handlerErr := i.runHandler(ctx, task, l)
+	end := finished()
+
+	// the run is recorded even if the task has been stopped meanwhile, so the writes do not use the task context
+	writeCtx := context.Background()
+
+	outcome := models.OutcomeSucceeded
+	switch {
+	case handlerErr == nil:
+	case errors.Is(handlerErr, ErrHandlerTimeout):
+		outcome = models.OutcomeTimedOut
+		i.logger.Log(ctx, logger.LogLevelError, "handler function has timed out", map[string]interface{}{"task_name": task.Name, "timeout": task.Timeout.String()})
+	default:
+		outcome = models.OutcomeFailed
+		i.logger.Log(ctx, logger.LogLevelError, "handler function has failed", map[string]interface{}{"task_name": task.Name, "error": handlerErr})
+	}
+
+	i.addExecution(writeCtx, task.Name, models.Execution{
+		Start:    start,
+		End:      end,
+		Duration: end.Sub(start),
+		NodeID:   i.nodeID,
+		RunID:    runID,
+		Outcome:  outcome,
+	}, handlerErr)
+
+	if handlerErr == nil {
+		return i.setSucceeded(writeCtx, task.Name, start, end, runID)
+	}
+
+	// the previous last action time is restored, so the next tick tries again instead of waiting for a full interval.
+	// The failed writes are only logged, the run has failed because of the handler anyway.
+	if err := unclaim(writeCtx); err != nil {
+		i.logger.Log(ctx, logger.LogLevelError, "failed to unclaim task", map[string]interface{}{"task_name": task.Name, "error": err})
+	}
+	if err := i.setLastFailure(writeCtx, task.Name, models.Failure{Time: end, Outcome: outcome, Error: handlerErr.Error()}); err != nil {
+		i.logger.Log(ctx, logger.LogLevelError, "failed to set last failure", map[string]interface{}{"task_name": task.Name, "error": err})
+	}
+	if err := i.setFailed(writeCtx, task.Name, start, end, runID); err != nil {
+		i.logger.Log(ctx, logger.LogLevelError, "failed to set state", map[string]interface{}{"task_name": task.Name, "error": err})
+	}
+	return &handlerError{err: handlerErr}
+}
+
+// handlerError is returned for a failed handler, so it is told apart from the backend errors on retries
+type handlerError struct {
+	err error
+}
+
+func (e *handlerError) Error() string {
+	return "handler function has failed: " + e.err.Error()
 }
 
-func (i *impl) isTimeSinceLastActionGreaterInterval(lastActionTime *time.Time, interval time.Duration) bool {
+func (e *handlerError) Unwrap() error {
+	return e.err
+}
+
+// claim checks that the task is still due and takes its slot, atomically if the backend is a backend.Claimer.
+// The returned func reverts the claim after a failed run.
+func (i *impl) claim(ctx context.Context, task models.Task, now time.Time) (func(ctx context.Context) error, bool, error) {
+	ctx, cancel := i.contextWithTimeout(ctx)
+	defer cancel()
+
+	isDue := func(lastActionTime *time.Time) bool {
+		return i.isDue(task, lastActionTime, now)
+	}
+
+	// a triggered run does not depend on the schedule, it only has to hold the lock
+	if isTriggered(ctx) {
+		unclaim := func(context.Context) error {
+			return nil
+		}
+		return unclaim, true, nil
+	}
+
+	claimer, ok := i.backend.(backend.Claimer)
+	if !ok {
+		lastActionTime, err := i.backend.GetLastActionTime(ctx, task.Name)
+		if err != nil {
+			return nil, false, err
+		}
+		unclaim := func(context.Context) error {
+			return nil
+		}
+		return unclaim, isDue(lastActionTime), nil
+	}
+
+	claimed, previous, err := claimer.Claim(ctx, task.Name, now, isDue)
+	if err != nil {
+		return nil, false, err
+	}
+	unclaim := func(ctx context.Context) error {
+		ctx, cancel := i.contextWithTimeout(ctx)
+		defer cancel()
+
+		return claimer.Unclaim(ctx, task.Name, now, previous)
+	}
+	return unclaim, claimed, nil
+}
+
+// runHandler calls the task handler with a context which lives for the single execution only,
+// the context is cancelled if the lock is lost or the task timeout is reached
+func (i *impl) runHandler(ctx context.Context, task models.Task, l backend.Lock) error {
+	var (
+		runCtx context.Context
+		cancel context.CancelFunc
+	)
+	if task.Timeout > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, task.Timeout)
+	} else {
+		runCtx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	watcherDone := make(chan struct{})
+	go func() {
+		defer close(watcherDone)
+
+		select {
+		case <-runCtx.Done():
+		case <-l.Lost():
+			i.logger.Log(ctx, logger.LogLevelError, "lock has been lost, cancelling handler", map[string]interface{}{"task_name": task.Name})
+			if i.opts.OnLockLost != nil {
+				i.opts.OnLockLost(task.Name)
+			}
+			cancel()
+		}
+	}()
+
+	handlerDone := make(chan error, 1)
+	go func() {
+		handlerDone <- i.callHandler(runCtx, task)
+	}()
+
+	var err error
+	select {
+	case err = <-handlerDone:
+	case <-runCtx.Done():
+		if !isTimeout(ctx, runCtx) {
+			err = <-handlerDone
+		} else {
+			// a handler ignoring its context is not waited for, so the lock is not held past the timeout
+			select {
+			case err = <-handlerDone:
+			default:
+				i.logger.Log(ctx, logger.LogLevelWarn, "handler function ignores its context, the lock is released anyway", map[string]interface{}{"task_name": task.Name})
+			}
+		}
+	}
+	// a handler ignoring its context may still return nil after the deadline, the run is timed out anyway
+	timedOut := task.Timeout > 0 && isTimeout(ctx, runCtx)
+	cancel()
+	<-watcherDone
+
+	if timedOut && err != nil {
+		return fmt.Errorf("%w after %s: %v", ErrHandlerTimeout, task.Timeout, err)
+	}
+	if timedOut {
+		return fmt.Errorf("%w after %s", ErrHandlerTimeout, task.Timeout)
+	}
+	return err
+}
+
+// isTimeout checks that the run context has reached its deadline and has not been cancelled by the task context
+func isTimeout(ctx, runCtx context.Context) bool {
+	return errors.Is(runCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil
+}
+
+// callHandler recovers a handler panic, so it does not crash the process and the lock is released
+func (i *impl) callHandler(ctx context.Context, task models.Task) (err error) {
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+
+		stack := debug.Stack()
+		i.logger.Log(ctx, logger.LogLevelError, "handler function has panicked", map[string]interface{}{
+			"task_name": task.Name,
+			"panic":     fmt.Sprint(recovered),
+			"stack":     string(stack),
+		})
+		if i.opts.OnPanic != nil {
+			i.opts.OnPanic(task.Name, recovered, stack)
+		}
+
+		err = fmt.Errorf("%w: %v", ErrHandlerPanic, recovered)
+	}()
+
+	return task.Handler(ctx)
+}
+
+func (i *impl) acquire(ctx context.Context, taskName string) (backend.Lock, error) {
+	ctx, cancel := i.contextWithTimeout(ctx)
+	defer cancel()
+
+	return i.backend.Acquire(ctx, taskName, i.opts.LockTTL)
+}
+
+// release does not depend on the task context, so the lock is released even if the task is stopping
+func (i *impl) release(l backend.Lock) error {
+	ctx, cancel := i.contextWithTimeout(context.Background())
+	defer cancel()
+
+	return l.Release(ctx)
+}
+
+func (i *impl) contextWithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if i.opts.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, i.opts.Timeout)
+}
+
+// isDue checks that the task has not been run yet by any node for the current schedule slot
+func (i *impl) isDue(task models.Task, lastActionTime *time.Time, now time.Time) bool {
+	if task.Location != nil {
+		now = now.In(task.Location)
+	}
+
+	switch task.TickerType {
+	case models.TickerCron:
+		if lastActionTime == nil {
+			return true
+		}
+		// the slot is taken when the last action happened after the latest fire time
+		return !task.Cron.Next(lastActionTime.In(now.Location())).After(now)
+	case models.TickerTime:
+		if lastActionTime == nil {
+			return true
+		}
+		// like with cron, a run finishing or retried after midnight does not take the slot of the next day
+		return !models.NextTime(lastActionTime.In(now.Location()), task.Hour, task.Minute, task.Second).After(now)
+	default:
+		return i.isTimeSinceLastActionGreaterInterval(lastActionTime, now, task.Interval)
+	}
+}
+
+// isTimeSinceLastActionGreaterInterval tolerates a tenth of the interval up to maxTickJitter: ticks come an interval apart,
+// but the time they are handled at varies, so a tick handled a bit earlier than the previous one is not skipped
+func (i *impl) isTimeSinceLastActionGreaterInterval(lastActionTime *time.Time, now time.Time, interval time.Duration) bool {
 	if lastActionTime == nil {
 		return true
 	}
 
-	return time.Since(*lastActionTime) > interval
+	jitter := interval / 10
+	if jitter > maxTickJitter {
+		jitter = maxTickJitter
+	}
+	return now.Sub(*lastActionTime) > interval-jitter
+}
+
+func (i *impl) checkServerTime() {
+	if _, ok := i.backend.(backend.Clock); i.opts.ServerTime && !ok {
+		i.logger.Log(context.Background(), logger.LogLevelWarn, "backend has no clock, local time is used", map[string]interface{}{})
+	}
+}
+
+// now returns the time used for due-ness decisions and stored timestamps,
+// with Options.ServerTime it is taken from the backend clock
+func (i *impl) now(ctx context.Context) (time.Time, error) {
+	clock, ok := i.backend.(backend.Clock)
+	if !i.opts.ServerTime || !ok {
+		return time.Now(), nil
+	}
+
+	ctx, cancel := i.contextWithTimeout(ctx)
+	defer cancel()
+
+	before := time.Now()
+	out, err := clock.Now(ctx)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get server time: %w", err)
+	}
+
+	// the server time is compared with the middle of the round trip
+	local := before.Add(time.Since(before) / 2)
+	i.checkClockSkew(ctx, "", "local clock differs from the server one", out.Sub(local))
+	return out, nil
+}
+
+// checkClockSkew logs a warning if the skew exceeds Options.MaxClockSkew
+func (i *impl) checkClockSkew(ctx context.Context, taskName, msg string, skew time.Duration) {
+	maxSkew := i.opts.MaxClockSkew
+	if maxSkew <= 0 {
+		maxSkew = defaultMaxClockSkew
+	}
+	if skew <= maxSkew && skew >= -maxSkew {
+		return
+	}
+
+	fields := map[string]interface{}{"skew": skew.String()}
+	if taskName != "" {
+		fields["task_name"] = taskName
+	}
+	i.logger.Log(ctx, logger.LogLevelWarn, msg, fields)
 }
 
 func (i *impl) getLastActionTime(ctx context.Context, taskName string) (*time.Time, error) {
-	res, err := i.etcd.Get(ctx, taskName)
+	ctx, cancel := i.contextWithTimeout(ctx)
+	defer cancel()
+
+	return i.backend.GetLastActionTime(ctx, taskName)
+}
+
+func (i *impl) setLastActionTime(ctx context.Context, taskName string, t time.Time) error {
+	ctx, cancel := i.contextWithTimeout(ctx)
+	defer cancel()
+
+	return i.backend.SetLastActionTime(ctx, taskName, t)
+}
+
+// addExecution records the execution in the history, a failed write is only logged,
+// so it does not make the execution retried
+func (i *impl) addExecution(ctx context.Context, taskName string, execution models.Execution, handlerErr error) {
+	store, ok := i.backend.(backend.HistoryStore)
+	if i.opts.History == nil || !ok {
+		return
+	}
+
+	if handlerErr != nil {
+		execution.Error = handlerErr.Error()
+	}
+
+	retention := *i.opts.History
+	if retention.MaxCount == 0 && retention.MaxAge == 0 {
+		retention.MaxCount = defaultHistoryMaxCount
+	}
+
+	ctx, cancel := i.contextWithTimeout(ctx)
+	defer cancel()
+
+	if err := store.AddExecution(ctx, taskName, execution, retention); err != nil {
+		i.logger.Log(ctx, logger.LogLevelError, "failed to add execution to history", map[string]interface{}{"task_name": taskName, "error": err})
+	}
+}
+
+func (i *impl) History(ctx context.Context, name string, limit int) ([]models.Execution, error) {
+	store, ok := i.backend.(backend.HistoryStore)
+	if !ok {
+		return nil, ErrHistoryNotSupported
+	}
+
+	ctx, cancel := i.contextWithTimeout(ctx)
+	defer cancel()
+
+	out, err := store.History(ctx, name, limit)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to get history: %w", err)
 	}
-	if len(res.Kvs) == 0 {
-		return nil, nil
+	return out, nil
+}
+
+func (i *impl) checkHistory() {
+	if _, ok := i.backend.(backend.HistoryStore); i.opts.History != nil && !ok {
+		i.logger.Log(context.Background(), logger.LogLevelWarn, "backend does not support execution history, executions are not recorded", map[string]interface{}{})
+	}
+}
+
+func nodeID(opts *Options) string {
+	if opts.NodeID != "" {
+		return opts.NodeID
 	}
-	out, err := time.Parse(time.RFC3339, string(res.Kvs[0].Value))
+
+	hostname, err := os.Hostname()
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse last action time: %w", err)
+		return "unknown"
 	}
-	return &out, nil
+	return hostname
 }
 
-func (i *impl) setLastActionTime(ctx context.Context, taskName string, t time.Time) error {
-	if _, err := i.etcd.Put(ctx, taskName, t.Format(time.RFC3339)); err != nil {
-		return fmt.Errorf("failed to set last action time: %w", err)
+// setSucceeded keeps the last action time at the start of the run, which is the claimed slot, the next slot is
+// measured from it, so a long run does not delay it. Backends implementing backend.StateStore get the whole record
+// of the run in one write.
+func (i *impl) setSucceeded(ctx context.Context, taskName string, start, end time.Time, runID string) error {
+	store, ok := i.backend.(backend.StateStore)
+	if !ok {
+		return i.setLastActionTime(ctx, taskName, start)
 	}
-	return nil
+
+	ctx, cancel := i.contextWithTimeout(ctx)
+	defer cancel()
+
+	return store.UpdateState(ctx, taskName, func(state models.State) models.State {
+		state.LastAction = &start
+		state.LastStart = &start
+		state.LastFinish = &end
+		state.LastSuccess = &end
+		state.ConsecutiveFailures = 0
+		state.NodeID = i.nodeID
+		state.RunID = runID
+		return state
+	})
+}
+
+// setFailed records the failed run in the state record, the last action time has been reverted by the unclaim already
+func (i *impl) setFailed(ctx context.Context, taskName string, start, end time.Time, runID string) error {
+	store, ok := i.backend.(backend.StateStore)
+	if !ok {
+		return nil
+	}
+
+	ctx, cancel := i.contextWithTimeout(ctx)
+	defer cancel()
+
+	return store.UpdateState(ctx, taskName, func(state models.State) models.State {
+		state.LastStart = &start
+		state.LastFinish = &end
+		state.ConsecutiveFailures++
+		state.NodeID = i.nodeID
+		state.RunID = runID
+		return state
+	})
+}
+
+func newRunID() (string, error) {
+	data := make([]byte, 8)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
+
+func (i *impl) setLastFailure(ctx context.Context, taskName string, failure models.Failure) error {
+	ctx, cancel := i.contextWithTimeout(ctx)
+	defer cancel()
+
+	return i.backend.SetLastFailure(ctx, taskName, failure)
 }
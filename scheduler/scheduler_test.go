@@ -1,32 +1,50 @@
 package scheduler
 
 import (
-	"bou.ke/monkey"
 	"context"
+	"errors"
+	"github.com/skvoch/reter/scheduler/backend/etcdbackend"
+	"github.com/skvoch/reter/scheduler/backend/memorybackend"
 	"github.com/skvoch/reter/scheduler/logger/zerologadapter"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/rs/zerolog/log"
+	"github.com/skvoch/reter/scheduler/backend"
 	"github.com/skvoch/reter/scheduler/builder"
+	"github.com/skvoch/reter/scheduler/internal/schedulertest"
 	"github.com/skvoch/reter/scheduler/models"
 	"github.com/stretchr/testify/assert"
+	etcd "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
 )
 
 func makeScheduler(taskNames ...string) *impl {
 	out := &impl{
-		tasks:   make(map[string]interface{}),
+		tasks:   make(map[string]*taskEntry),
 		tasksMx: &sync.Mutex{},
 		logger:  zerologadapter.NewLogger(log.Logger),
 	}
 
 	for _, name := range taskNames {
-		out.tasks[name] = struct{}{}
+		out.tasks[name] = newTaskEntry(name, func() {})
 	}
 	return out
 }
 
+func makeMemoryScheduler(b *memorybackend.Backend, opts *Options) *impl {
+	if opts == nil {
+		opts = &Options{}
+	}
+	opts.LockTTL = time.Second
+	opts.Timeout = time.Second
+
+	return NewWithBackend(zerologadapter.NewLogger(log.Logger), b, opts).(*impl)
+}
+
 func DatePtr(year int, month time.Month, day, hour, min, sec, nsec int) *time.Time {
 	if year == 0 && month == 0 && day == 0 && hour == 0 && sec == 0 && nsec == 0 {
 		return nil
@@ -100,22 +118,110 @@ func TestIsTimeSinceLastActionGreaterInterval(t *testing.T) {
 			Interval:       time.Minute * 15,
 			Expect:         true,
 		},
+		{
+			Name:           "#4 tick handled a bit earlier than the previous one",
+			LastActionTime: DatePtr(2021, 01, 01, 12, 0, 0, 3000000),
+			Now:            time.Date(2021, 01, 01, 12, 15, 0, 1000000, time.UTC),
+			Interval:       time.Minute * 15,
+			Expect:         true,
+		},
+		{
+			Name:           "#5 jitter is a tenth of a short interval",
+			LastActionTime: DatePtr(2021, 01, 01, 12, 0, 0, 0),
+			Now:            time.Date(2021, 01, 01, 12, 0, 0, 150000000, time.UTC),
+			Interval:       time.Millisecond * 200,
+			Expect:         false,
+		},
 	}
 
 	impl := impl{}
 	for _, c := range cases {
 		t.Run(c.Name, func(t *testing.T) {
-			monkey.Patch(time.Now, func() time.Time {
-				return c.Now
-			})
-
-			result := impl.isTimeSinceLastActionGreaterInterval(c.LastActionTime, c.Interval)
+			result := impl.isTimeSinceLastActionGreaterInterval(c.LastActionTime, c.Now, c.Interval)
 			assert.Equal(t, c.Expect, result)
 		})
 	}
 
 }
 
+func TestIsDue(t *testing.T) {
+	cron, err := models.ParseCron("0 */15 * * * *")
+	assert.NoError(t, err)
+
+	cases := []struct {
+		Name           string
+		Task           models.Task
+		LastActionTime *time.Time
+		Now            time.Time
+
+		Expect bool
+	}{
+		{
+			Name:           "#1 daily, never run",
+			Task:           models.Task{TickerType: models.TickerTime, Hour: 9, Minute: 30},
+			LastActionTime: nil,
+			Now:            time.Date(2021, 01, 02, 9, 30, 0, 0, time.UTC),
+			Expect:         true,
+		},
+		{
+			Name:           "#2 daily, run yesterday",
+			Task:           models.Task{TickerType: models.TickerTime, Hour: 9, Minute: 30},
+			LastActionTime: DatePtr(2021, 01, 01, 9, 30, 5, 0),
+			Now:            time.Date(2021, 01, 02, 9, 30, 0, 0, time.UTC),
+			Expect:         true,
+		},
+		{
+			Name:           "#3 daily, already run today",
+			Task:           models.Task{TickerType: models.TickerTime, Hour: 9, Minute: 30},
+			LastActionTime: DatePtr(2021, 01, 02, 9, 30, 1, 0),
+			Now:            time.Date(2021, 01, 02, 9, 30, 3, 0, time.UTC),
+			Expect:         false,
+		},
+		{
+			Name:           "#4 daily, slot is taken from the task location",
+			Task:           models.Task{TickerType: models.TickerTime, Hour: 9, Minute: 30, Location: time.FixedZone("JST", 9*60*60)},
+			LastActionTime: DatePtr(2021, 01, 01, 0, 30, 5, 0),
+			Now:            time.Date(2021, 01, 01, 12, 0, 0, 0, time.UTC),
+			Expect:         false,
+		},
+		{
+			Name:           "#5 daily, previous run finished after midnight",
+			Task:           models.Task{TickerType: models.TickerTime, Hour: 23, Minute: 59, Second: 30},
+			LastActionTime: DatePtr(2021, 01, 02, 0, 0, 10, 0),
+			Now:            time.Date(2021, 01, 02, 23, 59, 30, 0, time.UTC),
+			Expect:         true,
+		},
+		{
+			Name:           "#6 daily, retry of the previous slot after midnight",
+			Task:           models.Task{TickerType: models.TickerTime, Hour: 23, Minute: 59, Second: 30},
+			LastActionTime: DatePtr(2020, 12, 31, 23, 59, 31, 0),
+			Now:            time.Date(2021, 01, 02, 0, 0, 3, 0, time.UTC),
+			Expect:         true,
+		},
+		{
+			Name:           "#7 cron, previous slot",
+			Task:           models.Task{TickerType: models.TickerCron, Cron: cron},
+			LastActionTime: DatePtr(2021, 01, 01, 12, 0, 2, 0),
+			Now:            time.Date(2021, 01, 01, 12, 15, 0, 0, time.UTC),
+			Expect:         true,
+		},
+		{
+			Name:           "#8 cron, current slot already taken",
+			Task:           models.Task{TickerType: models.TickerCron, Cron: cron},
+			LastActionTime: DatePtr(2021, 01, 01, 12, 15, 1, 0),
+			Now:            time.Date(2021, 01, 01, 12, 15, 2, 0, time.UTC),
+			Expect:         false,
+		},
+	}
+
+	impl := impl{}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			assert.Equal(t, c.Expect, impl.isDue(c.Task, c.LastActionTime, c.Now))
+		})
+	}
+}
+
 func TestValidateTask(t *testing.T) {
 
 	cases := []struct {
@@ -131,7 +237,7 @@ func TestValidateTask(t *testing.T) {
 			Task: models.Task{
 				Interval: time.Second,
 				Name:     "name",
-				Handler:  func() {},
+				Handler:  func(context.Context) error { return nil },
 			},
 		},
 		{
@@ -145,13 +251,22 @@ func TestValidateTask(t *testing.T) {
 			},
 		},
 		{
-			Name:      "#3 not unique task name",
+			Name:      "#3 zero interval",
+			IsValid:   false,
+			Scheduler: makeScheduler(),
+			Task: models.Task{
+				Name:    "name",
+				Handler: func(context.Context) error { return nil },
+			},
+		},
+		{
+			Name:      "#4 not unique task name",
 			IsValid:   false,
 			Scheduler: makeScheduler("get_data"),
 			Task: models.Task{
 				Interval: time.Second,
 				Name:     "get_data",
-				Handler:  func() {},
+				Handler:  func(context.Context) error { return nil },
 			},
 		},
 	}
@@ -168,3 +283,1206 @@ func TestValidateTask(t *testing.T) {
 		})
 	}
 }
+
+func TestAttempt(t *testing.T) {
+	assert.Equal(t, 1, Attempt(context.Background()))
+	assert.Equal(t, 3, Attempt(withAttempt(context.Background(), 3)))
+}
+
+func TestCallHandler(t *testing.T) {
+	var (
+		panicTask      string
+		panicRecovered interface{}
+		panicStack     []byte
+	)
+
+	s := makeScheduler()
+	s.opts = &Options{
+		OnPanic: func(taskName string, recovered interface{}, stack []byte) {
+			panicTask, panicRecovered, panicStack = taskName, recovered, stack
+		},
+	}
+
+	err := s.callHandler(context.Background(), models.Task{
+		Name: "panic",
+		Handler: func(context.Context) error {
+			panic("boom")
+		},
+	})
+
+	assert.ErrorIs(t, err, ErrHandlerPanic)
+	assert.Equal(t, "panic", panicTask)
+	assert.Equal(t, "boom", panicRecovered)
+	assert.NotEmpty(t, panicStack)
+
+	err = s.callHandler(context.Background(), models.Task{
+		Name: "ok",
+		Handler: func(context.Context) error {
+			return nil
+		},
+	})
+	assert.NoError(t, err)
+}
+
+func TestRunWithMemoryBackend(t *testing.T) {
+	b := memorybackend.New()
+
+	// two nodes sharing the same backend
+	schedulertest.CheckIntervalTask(t, func() schedulertest.Scheduler {
+		return makeMemoryScheduler(b, nil)
+	})
+}
+
+func TestHandlerOutcome(t *testing.T) {
+	cases := []struct {
+		Name    string
+		Task    models.Task
+		Outcome models.Outcome
+		IsError bool
+	}{
+		{
+			Name: "#1 success",
+			Task: models.Task{
+				Handler: func(context.Context) error { return nil },
+			},
+		},
+		{
+			Name: "#2 failure",
+			Task: models.Task{
+				Handler: func(context.Context) error { return errors.New("failure") },
+			},
+			Outcome: models.OutcomeFailed,
+			IsError: true,
+		},
+		{
+			Name: "#3 timeout",
+			Task: models.Task{
+				Timeout: time.Millisecond * 10,
+				Handler: func(ctx context.Context) error {
+					<-ctx.Done()
+					return ctx.Err()
+				},
+			},
+			Outcome: models.OutcomeTimedOut,
+			IsError: true,
+		},
+		{
+			Name: "#4 timeout ignored by the handler",
+			Task: models.Task{
+				Timeout: time.Millisecond * 10,
+				Handler: func(ctx context.Context) error {
+					time.Sleep(time.Millisecond * 20)
+					return nil
+				},
+			},
+			Outcome: models.OutcomeTimedOut,
+			IsError: true,
+		},
+		{
+			Name: "#5 panic",
+			Task: models.Task{
+				Handler: func(context.Context) error { panic("boom") },
+			},
+			Outcome: models.OutcomeFailed,
+			IsError: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			b := memorybackend.New()
+			s := makeMemoryScheduler(b, nil)
+
+			c.Task.Name = "task"
+			c.Task.Interval = time.Minute
+			err := s.handler(context.Background(), c.Task)
+
+			last, lastErr := b.GetLastActionTime(context.Background(), "task")
+			assert.NoError(t, lastErr)
+			failure, failed := b.LastFailure("task")
+			assert.False(t, b.IsLocked("task"))
+
+			if !c.IsError {
+				assert.NoError(t, err)
+				assert.NotNil(t, last)
+				assert.False(t, failed)
+				return
+			}
+
+			assert.Error(t, err)
+			assert.Nil(t, last)
+			assert.True(t, failed)
+			assert.Equal(t, c.Outcome, failure.Outcome)
+		})
+	}
+}
+
+func TestTimeoutReleasesLock(t *testing.T) {
+	b := memorybackend.New()
+	s := makeMemoryScheduler(b, nil)
+
+	finish := make(chan struct{})
+	defer close(finish)
+
+	start := time.Now()
+	err := s.handler(context.Background(), models.Task{
+		Name:     "task",
+		Interval: time.Minute,
+		Timeout:  time.Millisecond * 10,
+		Handler: func(ctx context.Context) error {
+			// the handler ignores its context
+			<-finish
+			return nil
+		},
+	})
+
+	assert.ErrorIs(t, err, ErrHandlerTimeout)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	assert.False(t, b.IsLocked("task"))
+
+	failure, failed := b.LastFailure("task")
+	assert.True(t, failed)
+	assert.Equal(t, models.OutcomeTimedOut, failure.Outcome)
+}
+
+func TestStoppedRunIsRecorded(t *testing.T) {
+	b := memorybackend.New()
+	s := makeMemoryScheduler(b, &Options{History: &models.Retention{}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	err := s.handler(ctx, models.Task{
+		Name:     "task",
+		Interval: time.Minute,
+		Handler: func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+	assert.Error(t, err)
+
+	// the writes after the run do not fail with the cancelled task context
+	last, err := b.GetLastActionTime(context.Background(), "task")
+	assert.NoError(t, err)
+	assert.Nil(t, last)
+
+	_, failed := b.LastFailure("task")
+	assert.True(t, failed)
+
+	history, err := b.History(context.Background(), "task", 0)
+	assert.NoError(t, err)
+	assert.Len(t, history, 1)
+	assert.False(t, b.IsLocked("task"))
+}
+
+func TestLockLost(t *testing.T) {
+	var lostTask string
+
+	b := memorybackend.New()
+	s := makeMemoryScheduler(b, &Options{
+		OnLockLost: func(taskName string) {
+			lostTask = taskName
+		},
+	})
+
+	err := s.handler(context.Background(), models.Task{
+		Name:     "task",
+		Interval: time.Minute,
+		Handler: func(ctx context.Context) error {
+			b.Expire("task")
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, "task", lostTask)
+}
+
+func TestExecuteRetry(t *testing.T) {
+	var attempts []int
+
+	b := memorybackend.New()
+	s := makeMemoryScheduler(b, nil)
+
+	err := s.execute(context.Background(), models.Task{
+		Name:     "task",
+		Interval: time.Minute,
+		Retry:    &models.RetryPolicy{MaxAttempts: 5, InitialInterval: time.Millisecond},
+		Handler: func(ctx context.Context) error {
+			attempts = append(attempts, Attempt(ctx))
+			if len(attempts) < 3 {
+				return errors.New("failure")
+			}
+			return nil
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, attempts)
+
+	last, err := b.GetLastActionTime(context.Background(), "task")
+	assert.NoError(t, err)
+	assert.NotNil(t, last)
+}
+
+// flakyBackend fails to read the last action time the given number of times
+type flakyBackend struct {
+	*memorybackend.Backend
+	failures int32
+}
+
+func (b *flakyBackend) GetLastActionTime(ctx context.Context, taskName string) (*time.Time, error) {
+	if atomic.AddInt32(&b.failures, -1) >= 0 {
+		return nil, errors.New("backend is not available")
+	}
+	return b.Backend.GetLastActionTime(ctx, taskName)
+}
+
+func TestExecuteDefaultRetry(t *testing.T) {
+	policy := defaultTimeRetryPolicy
+	defaultTimeRetryPolicy.InitialInterval = time.Millisecond
+	defer func() {
+		defaultTimeRetryPolicy = policy
+	}()
+
+	cases := []struct {
+		Name            string
+		TickerType      models.TickerType
+		BackendFailures int32
+		HandlerErr      error
+		Executions      int
+		IsValid         bool
+	}{
+		{
+			Name:       "#1 daily handler error is not retried",
+			TickerType: models.TickerTime,
+			HandlerErr: errors.New("failure"),
+			Executions: 1,
+			IsValid:    false,
+		},
+		{
+			Name:            "#2 daily backend error is retried",
+			TickerType:      models.TickerTime,
+			BackendFailures: 2,
+			Executions:      1,
+			IsValid:         true,
+		},
+		{
+			Name:            "#3 interval backend error is not retried",
+			TickerType:      models.TickerInterval,
+			BackendFailures: 2,
+			Executions:      0,
+			IsValid:         false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var executions int
+
+			b := &flakyBackend{Backend: memorybackend.New(), failures: c.BackendFailures}
+			s := NewWithBackend(zerologadapter.NewLogger(log.Logger), b, &Options{
+				LockTTL: time.Second,
+				Timeout: time.Second,
+			}).(*impl)
+
+			err := s.execute(context.Background(), models.Task{
+				Name:       "task",
+				TickerType: c.TickerType,
+				Interval:   time.Minute,
+				Location:   time.UTC,
+				Handler: func(context.Context) error {
+					executions++
+					return c.HandlerErr
+				},
+			})
+
+			assert.Equal(t, c.IsValid, err == nil)
+			assert.Equal(t, c.Executions, executions)
+		})
+	}
+}
+
+// lateBackend imitates another node which runs the task and releases the lock
+// after the last action time has been read, but before the lock is acquired
+type lateBackend struct {
+	*memorybackend.Backend
+}
+
+func (b *lateBackend) Acquire(ctx context.Context, taskName string, ttl time.Duration) (backend.Lock, error) {
+	if err := b.SetLastActionTime(ctx, taskName, time.Now()); err != nil {
+		return nil, err
+	}
+	return b.Backend.Acquire(ctx, taskName, ttl)
+}
+
+func TestClaim(t *testing.T) {
+	cases := []struct {
+		Name    string
+		Backend func(b *memorybackend.Backend) backend.Backend
+	}{
+		{
+			Name: "#1 claimer",
+			Backend: func(b *memorybackend.Backend) backend.Backend {
+				return &lateBackend{Backend: b}
+			},
+		},
+		{
+			Name: "#2 re-read without claimer",
+			Backend: func(b *memorybackend.Backend) backend.Backend {
+				// the wrapper hides the backend.Claimer methods
+				return struct{ backend.Backend }{&lateBackend{Backend: b}}
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var executions int
+
+			b := memorybackend.New()
+			s := NewWithBackend(zerologadapter.NewLogger(log.Logger), c.Backend(b), &Options{
+				LockTTL: time.Second,
+				Timeout: time.Second,
+			}).(*impl)
+
+			err := s.handler(context.Background(), models.Task{
+				Name:     "task",
+				Interval: time.Minute,
+				Handler: func(context.Context) error {
+					executions++
+					return nil
+				},
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, 0, executions)
+			assert.False(t, b.IsLocked("task"))
+		})
+	}
+}
+
+// skewedBackend has a server clock which is an hour behind the local one
+type skewedBackend struct {
+	*memorybackend.Backend
+}
+
+func (b *skewedBackend) Now(ctx context.Context) (time.Time, error) {
+	return time.Now().Add(-time.Hour), nil
+}
+
+func TestServerTime(t *testing.T) {
+	cases := []struct {
+		Name       string
+		ServerTime bool
+		Expect     int
+	}{
+		{Name: "#1 server time", ServerTime: true, Expect: 0},
+		{Name: "#2 local time", ServerTime: false, Expect: 1},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var executions int
+
+			b := &skewedBackend{Backend: memorybackend.New()}
+			s := NewWithBackend(zerologadapter.NewLogger(log.Logger), b, &Options{
+				LockTTL:    time.Second,
+				Timeout:    time.Second,
+				ServerTime: c.ServerTime,
+			}).(*impl)
+
+			// the task has been run by a node with the server time half a minute ago
+			serverNow, err := b.Now(context.Background())
+			assert.NoError(t, err)
+			assert.NoError(t, b.SetLastActionTime(context.Background(), "task", serverNow.Add(-time.Second*30)))
+
+			err = s.handler(context.Background(), models.Task{
+				Name:     "task",
+				Interval: time.Minute,
+				Handler: func(context.Context) error {
+					executions++
+					return nil
+				},
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.Expect, executions)
+		})
+	}
+}
+
+func TestEtcdConfig(t *testing.T) {
+	config := etcdConfig(&Options{
+		Etcd: EtcdOptions{
+			Endpoints:         []string{"localhost:2379"},
+			Username:          "user",
+			Password:          "password",
+			AutoSyncInterval:  time.Minute,
+			DialTimeout:       time.Second * 5,
+			DialKeepAliveTime: time.Second * 10,
+		},
+	})
+
+	assert.Equal(t, []string{"localhost:2379"}, config.Endpoints)
+	assert.Equal(t, "user", config.Username)
+	assert.Equal(t, "password", config.Password)
+	assert.Equal(t, time.Minute, config.AutoSyncInterval)
+	assert.Equal(t, time.Second*5, config.DialTimeout)
+	assert.Equal(t, time.Second*10, config.DialKeepAliveTime)
+	assert.NotNil(t, config.LogConfig)
+	assert.Nil(t, config.Logger)
+
+	ctx := context.Background()
+	zapLogger := zap.NewNop()
+	config = etcdConfig(&Options{
+		Etcd: EtcdOptions{
+			DialOptions: []grpc.DialOption{grpc.WithBlock()},
+			Logger:      zapLogger,
+			Context:     ctx,
+		},
+	})
+
+	assert.Len(t, config.DialOptions, 1)
+	assert.Equal(t, zapLogger, config.Logger)
+	assert.Nil(t, config.LogConfig)
+	assert.Equal(t, ctx, config.Context)
+}
+
+func TestNewWithClient(t *testing.T) {
+	client := etcd.NewCtxClient(context.Background())
+
+	s, err := New(zerologadapter.NewLogger(log.Logger), &Options{
+		Etcd: EtcdOptions{
+			Client: client,
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.IsType(t, &etcdbackend.Backend{}, s.(*impl).backend)
+}
+
+func TestShutdown(t *testing.T) {
+	var (
+		b       = memorybackend.New()
+		s       = makeMemoryScheduler(b, nil)
+		started = make(chan struct{})
+		handled = make(chan error, 1)
+		done    = make(chan error, 1)
+	)
+
+	go func() {
+		done <- s.Every().Interval(time.Millisecond*10).DoCtx(context.Background(), "task", func(ctx context.Context) error {
+			close(started)
+			time.Sleep(time.Millisecond * 100)
+			handled <- ctx.Err()
+			return nil
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, s.Shutdown(ctx))
+
+	// the running handler has not been cancelled and the watcher has been stopped after it
+	assert.NoError(t, <-handled)
+	assert.NoError(t, <-done)
+	assert.False(t, b.IsLocked("task"))
+
+	err := s.Every().Interval(time.Millisecond*10).DoCtx(context.Background(), "other", func(ctx context.Context) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrSchedulerClosed)
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	var (
+		b       = memorybackend.New()
+		s       = makeMemoryScheduler(b, nil)
+		started = make(chan struct{})
+		unblock = make(chan struct{})
+		done    = make(chan error, 1)
+	)
+
+	go func() {
+		done <- s.Every().Interval(time.Millisecond*10).DoCtx(context.Background(), "task", func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			<-unblock
+			return ctx.Err()
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	err := s.Shutdown(ctx)
+
+	assert.ErrorIs(t, err, ErrShutdownTimeout)
+	assert.Contains(t, err.Error(), "task")
+	assert.False(t, b.IsLocked("task"))
+
+	close(unblock)
+	assert.NoError(t, <-done)
+}
+
+func TestStart(t *testing.T) {
+	var (
+		b        = memorybackend.New()
+		s        = makeMemoryScheduler(b, nil)
+		executed = make(chan struct{}, 1)
+	)
+
+	handle, err := s.Every().Interval(time.Millisecond*10).Start(context.Background(), "task", func(ctx context.Context) error {
+		select {
+		case executed <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "task", handle.Name())
+
+	// registration errors are returned right away
+	_, err = s.Every().Interval(time.Millisecond*10).Start(context.Background(), "task", func(ctx context.Context) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrNotUniqueTaskName)
+
+	select {
+	case <-executed:
+	case <-time.After(time.Second):
+		t.Fatal("task has not been executed")
+	}
+
+	handle.Stop()
+	select {
+	case <-handle.Done():
+	case <-time.After(time.Second):
+		t.Fatal("task has not been stopped")
+	}
+
+	// the name of a stopped task can be registered again
+	handle, err = s.Every().Interval(time.Hour).Start(context.Background(), "task", func(ctx context.Context) error {
+		return nil
+	})
+	assert.NoError(t, err)
+	handle.Stop()
+
+	s.Wait()
+}
+
+func TestTaskControl(t *testing.T) {
+	var (
+		b          = memorybackend.New()
+		s          = makeMemoryScheduler(b, nil)
+		executions = make(chan struct{}, 100)
+	)
+
+	handler := func(ctx context.Context) error {
+		executions <- struct{}{}
+		return nil
+	}
+	waitExecution := func(t *testing.T) {
+		select {
+		case <-executions:
+		case <-time.After(time.Second):
+			t.Fatal("task has not been executed")
+		}
+	}
+	assertNoExecution := func(t *testing.T) {
+		select {
+		case <-executions:
+			t.Fatal("task has been executed")
+		case <-time.After(time.Millisecond * 100):
+		}
+	}
+
+	handle, err := s.Every().Interval(time.Hour).Start(context.Background(), "task", handler)
+	assert.NoError(t, err)
+
+	t.Run("#1 trigger runs the task regardless of the schedule", func(t *testing.T) {
+		assert.NoError(t, s.TriggerNow("task"))
+		waitExecution(t)
+
+		// the task has just been run, so it is not due
+		assert.NoError(t, s.TriggerNow("task"))
+		waitExecution(t)
+	})
+
+	t.Run("#2 trigger takes the lock", func(t *testing.T) {
+		// the previous run releases the lock right after the handler has returned
+		for b.IsLocked("task") {
+			time.Sleep(time.Millisecond)
+		}
+
+		l, err := b.Acquire(context.Background(), "task", time.Second)
+		assert.NoError(t, err)
+
+		handle.TriggerNow()
+		assertNoExecution(t)
+		assert.NoError(t, l.Release(context.Background()))
+	})
+
+	t.Run("#3 pause and resume", func(t *testing.T) {
+		paused, err := s.Every().Interval(time.Millisecond*10).Start(context.Background(), "paused", handler)
+		assert.NoError(t, err)
+		waitExecution(t)
+
+		assert.NoError(t, s.Pause("paused"))
+		// an execution may be in progress while pausing
+		time.Sleep(time.Millisecond * 50)
+		for len(executions) != 0 {
+			<-executions
+		}
+		assertNoExecution(t)
+
+		paused.Resume()
+		waitExecution(t)
+		paused.Remove()
+	})
+
+	t.Run("#4 remove", func(t *testing.T) {
+		assert.NoError(t, s.Remove("task"))
+		select {
+		case <-handle.Done():
+		case <-time.After(time.Second):
+			t.Fatal("task has not been stopped")
+		}
+
+		assert.ErrorIs(t, s.TriggerNow("task"), ErrTaskNotFound)
+
+		// the name can be registered again
+		handle, err = s.Every().Interval(time.Hour).Start(context.Background(), "task", handler)
+		assert.NoError(t, err)
+		handle.Remove()
+	})
+
+	t.Run("#5 unknown task", func(t *testing.T) {
+		assert.ErrorIs(t, s.Pause("unknown"), ErrTaskNotFound)
+		assert.ErrorIs(t, s.Resume("unknown"), ErrTaskNotFound)
+		assert.ErrorIs(t, s.Remove("unknown"), ErrTaskNotFound)
+		assert.ErrorIs(t, s.TriggerNow("unknown"), ErrTaskNotFound)
+	})
+
+	s.Wait()
+}
+
+func TestClusterControl(t *testing.T) {
+	var (
+		b          = memorybackend.New()
+		executions = make(chan string, 100)
+	)
+
+	assertExecutions := func(t *testing.T, expected int) {
+		time.Sleep(time.Millisecond * 200)
+		assert.Equal(t, expected, len(executions))
+		for len(executions) != 0 {
+			<-executions
+		}
+	}
+
+	// the task is paused before the nodes have started
+	b.SetPaused("paused", true)
+
+	var schedulers []*impl
+	for _, node := range []string{"first", "second"} {
+		node := node
+		s := makeMemoryScheduler(b, nil)
+		schedulers = append(schedulers, s)
+
+		handler := func(ctx context.Context) error {
+			executions <- node
+			return nil
+		}
+
+		_, err := s.Every().Interval(time.Hour).Start(context.Background(), "task", handler)
+		assert.NoError(t, err)
+		_, err = s.Every().Interval(time.Millisecond*10).Start(context.Background(), "paused", handler)
+		assert.NoError(t, err)
+	}
+
+	t.Run("#1 trigger runs the task on one node", func(t *testing.T) {
+		// the nodes subscribe to the commands in the background, a trigger made before is kept for them
+		b.Trigger("task")
+		assertExecutions(t, 1)
+	})
+
+	t.Run("#2 paused on all nodes", func(t *testing.T) {
+		assertExecutions(t, 0)
+
+		// a trigger is run even if the task is paused
+		assert.True(t, b.Trigger("paused"))
+		assertExecutions(t, 1)
+	})
+
+	t.Run("#3 resumed on all nodes", func(t *testing.T) {
+		b.SetPaused("paused", false)
+		time.Sleep(time.Millisecond * 50)
+		assert.Greater(t, len(executions), 0)
+
+		for _, s := range schedulers {
+			assert.NoError(t, s.Remove("paused"))
+		}
+		assertExecutions(t, len(executions))
+	})
+
+	t.Run("#4 unknown task", func(t *testing.T) {
+		assert.False(t, b.Trigger("unknown"))
+	})
+
+	t.Run("#5 trigger waits for the lock held by another run", func(t *testing.T) {
+		l, err := b.Acquire(context.Background(), "task", time.Second)
+		assert.NoError(t, err)
+
+		assert.True(t, b.Trigger("task"))
+		assertExecutions(t, 0)
+
+		assert.NoError(t, l.Release(context.Background()))
+		time.Sleep(triggerRetryInterval)
+		assertExecutions(t, 1)
+	})
+
+	t.Run("#6 trigger made before the task has been started", func(t *testing.T) {
+		assert.False(t, b.Trigger("later"))
+
+		_, err := schedulers[0].Every().Interval(time.Hour).Start(context.Background(), "later", func(ctx context.Context) error {
+			executions <- "first"
+			return nil
+		})
+		assert.NoError(t, err)
+		assertExecutions(t, 1)
+	})
+
+	for _, s := range schedulers {
+		assert.NoError(t, s.Shutdown(context.Background()))
+	}
+}
+
+func TestDefinitions(t *testing.T) {
+	var (
+		b          = memorybackend.New()
+		s          = makeMemoryScheduler(b, nil)
+		executions = make(chan string, 100)
+	)
+
+	assert.NoError(t, s.RegisterHandler("echo", func(ctx context.Context, args map[string]string) error {
+		executions <- args["message"]
+		return nil
+	}))
+	assert.ErrorIs(t, s.RegisterHandler("echo", func(ctx context.Context, args map[string]string) error {
+		return nil
+	}), ErrNotUniqueHandlerName)
+	assert.ErrorIs(t, s.RegisterHandler("nil", nil), ErrNilHandler)
+
+	waitExecution := func(t *testing.T, expected string) {
+		select {
+		case message := <-executions:
+			assert.Equal(t, expected, message)
+		case <-time.After(time.Second):
+			t.Fatal("task has not been executed")
+		}
+	}
+	drain := func() {
+		time.Sleep(time.Millisecond * 50)
+		for len(executions) != 0 {
+			<-executions
+		}
+	}
+
+	// the definition put before watching is passed with the initial state
+	b.PutDefinition(models.Definition{Name: "task", Interval: "10ms", Handler: "echo", Args: map[string]string{"message": "first"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.WatchDefinitions(ctx)
+	}()
+
+	t.Run("#1 task is started", func(t *testing.T) {
+		waitExecution(t, "first")
+	})
+
+	t.Run("#2 task is restarted on change", func(t *testing.T) {
+		b.PutDefinition(models.Definition{Name: "task", Interval: "10ms", Handler: "echo", Args: map[string]string{"message": "second"}})
+		drain()
+		waitExecution(t, "second")
+	})
+
+	t.Run("#3 invalid definitions are not run", func(t *testing.T) {
+		b.PutDefinition(models.Definition{Name: "unknown", Interval: "10ms", Handler: "unknown"})
+		b.PutDefinition(models.Definition{Name: "no schedule", Handler: "echo"})
+		b.PutDefinition(models.Definition{Name: "two schedules", Interval: "10ms", Cron: "* * * * *", Handler: "echo"})
+
+		_, err := s.task("unknown")
+		assert.ErrorIs(t, err, ErrTaskNotFound)
+		_, err = s.task("no schedule")
+		assert.ErrorIs(t, err, ErrTaskNotFound)
+		_, err = s.task("two schedules")
+		assert.ErrorIs(t, err, ErrTaskNotFound)
+	})
+
+	t.Run("#4 task is stopped on delete", func(t *testing.T) {
+		b.DeleteDefinition("task")
+		drain()
+
+		select {
+		case <-executions:
+			t.Fatal("deleted task has been executed")
+		case <-time.After(time.Millisecond * 100):
+		}
+		_, err := s.task("task")
+		assert.ErrorIs(t, err, ErrTaskNotFound)
+	})
+
+	t.Run("#5 tasks are removed when the watch ends", func(t *testing.T) {
+		b.PutDefinition(models.Definition{Name: "task", Interval: "10ms", Handler: "echo", Args: map[string]string{"message": "third"}})
+		waitExecution(t, "third")
+
+		cancel()
+		assert.NoError(t, <-done)
+
+		_, err := s.task("task")
+		assert.ErrorIs(t, err, ErrTaskNotFound)
+	})
+
+	t.Run("#6 not supported", func(t *testing.T) {
+		s := NewWithBackend(zerologadapter.NewLogger(log.Logger), struct{ backend.Backend }{b}, &Options{})
+		assert.ErrorIs(t, s.WatchDefinitions(context.Background()), ErrDefinitionsNotSupported)
+	})
+}
+
+func TestReschedule(t *testing.T) {
+	var (
+		b          = memorybackend.New()
+		s          = makeMemoryScheduler(b, nil)
+		executions = make(chan struct{}, 100)
+	)
+
+	waitExecution := func(t *testing.T) {
+		select {
+		case <-executions:
+		case <-time.After(time.Second * 2):
+			t.Fatal("task has not been executed")
+		}
+	}
+	assertNoExecution := func(t *testing.T) {
+		// an execution may be in progress while rescheduling
+		time.Sleep(time.Millisecond * 50)
+		for len(executions) != 0 {
+			<-executions
+		}
+
+		select {
+		case <-executions:
+			t.Fatal("task has been executed")
+		case <-time.After(time.Millisecond * 100):
+		}
+	}
+
+	handle, err := s.Every().Interval(time.Hour).Start(context.Background(), "task", func(ctx context.Context) error {
+		executions <- struct{}{}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	often, err := s.Every().Interval(time.Millisecond * 10).Schedule()
+	assert.NoError(t, err)
+	rarely, err := s.Every().Interval(time.Hour).Schedule()
+	assert.NoError(t, err)
+
+	t.Run("#1 shorter interval", func(t *testing.T) {
+		assert.NoError(t, s.Reschedule("task", often))
+		waitExecution(t)
+	})
+
+	t.Run("#2 longer interval keeps the last action time", func(t *testing.T) {
+		assert.NoError(t, s.Reschedule("task", rarely))
+		assertNoExecution(t)
+
+		// the task has just been run, so it is not due with the new interval even after a restart
+		assert.NoError(t, s.Reschedule("task", rarely))
+		assertNoExecution(t)
+	})
+
+	t.Run("#3 to cron", func(t *testing.T) {
+		cron, err := s.Cron("* * * * * *").Schedule()
+		assert.NoError(t, err)
+
+		assert.NoError(t, s.Reschedule("task", cron))
+		waitExecution(t)
+	})
+
+	t.Run("#4 invalid schedule", func(t *testing.T) {
+		assert.ErrorIs(t, s.Reschedule("task", models.Schedule{TickerType: models.TickerInterval}), ErrInvalidSchedule)
+		assert.ErrorIs(t, s.Reschedule("task", models.Schedule{TickerType: models.TickerCron}), ErrInvalidSchedule)
+	})
+
+	t.Run("#5 unknown task", func(t *testing.T) {
+		assert.ErrorIs(t, s.Reschedule("unknown", often), ErrTaskNotFound)
+	})
+
+	handle.Stop()
+	s.Wait()
+}
+
+func TestRescheduleDefaultRetry(t *testing.T) {
+	policy := defaultTimeRetryPolicy
+	defaultTimeRetryPolicy.InitialInterval = time.Minute
+	defer func() {
+		defaultTimeRetryPolicy = policy
+	}()
+
+	var (
+		b          = &flakyBackend{Backend: memorybackend.New()}
+		s          = NewWithBackend(zerologadapter.NewLogger(log.Logger), b, &Options{Timeout: time.Second}).(*impl)
+		executions = make(chan struct{}, 100)
+	)
+
+	handle, err := s.Every().At("00:00").Start(context.Background(), "task", func(ctx context.Context) error {
+		executions <- struct{}{}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	often, err := s.Every().Interval(time.Millisecond * 10).Schedule()
+	assert.NoError(t, err)
+
+	// the interval ticks fail on the backend until they run the handler, they are not retried a minute later
+	atomic.StoreInt32(&b.failures, 3)
+	assert.NoError(t, s.Reschedule("task", often))
+	select {
+	case <-executions:
+	case <-time.After(time.Second * 2):
+		t.Fatal("task has not been executed")
+	}
+
+	handle.Stop()
+	s.Wait()
+}
+
+func TestNextRun(t *testing.T) {
+	schedule := models.Schedule{TickerType: models.TickerInterval, Interval: time.Minute}
+	next := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		Name           string
+		Schedule       models.Schedule
+		LastActionTime *time.Time
+		Expected       time.Time
+	}{
+		{
+			Name:     "#1 never run",
+			Schedule: schedule,
+			Expected: next,
+		},
+		{
+			Name:           "#2 due at the next tick",
+			Schedule:       schedule,
+			LastActionTime: DatePtr(2021, 6, 1, 11, 58, 0, 0),
+			Expected:       next,
+		},
+		{
+			Name:           "#3 run on another node after the previous tick",
+			Schedule:       schedule,
+			LastActionTime: DatePtr(2021, 6, 1, 11, 59, 30, 0),
+			Expected:       time.Date(2021, 6, 1, 12, 1, 0, 0, time.UTC),
+		},
+		{
+			Name:           "#4 daily",
+			Schedule:       models.Schedule{TickerType: models.TickerTime, Hour: 12},
+			LastActionTime: DatePtr(2021, 6, 1, 11, 59, 30, 0),
+			Expected:       next,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			assert.Equal(t, c.Expected, nextRun(c.Schedule, next, c.LastActionTime))
+		})
+	}
+}
+
+func TestTasks(t *testing.T) {
+	var (
+		b       = memorybackend.New()
+		s       = makeMemoryScheduler(b, nil)
+		running = make(chan struct{})
+		release = make(chan struct{})
+	)
+
+	_, err := s.Every().Interval(time.Hour).Start(context.Background(), "interval", func(ctx context.Context) error {
+		running <- struct{}{}
+		<-release
+		return nil
+	})
+	assert.NoError(t, err)
+	_, err = s.Cron("0 9 * * MON").Start(context.Background(), "cron", func(ctx context.Context) error {
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, s.Pause("cron"))
+
+	last := time.Now().Add(-time.Minute)
+	assert.NoError(t, b.SetLastActionTime(context.Background(), "interval", last))
+
+	// the watchers plan their first run in the background
+	for {
+		tasks, err := s.Tasks(context.Background())
+		assert.NoError(t, err)
+		if !tasks[0].NextRun.IsZero() && !tasks[1].NextRun.IsZero() {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	tasks, err := s.Tasks(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+
+	assert.Equal(t, "cron", tasks[0].Name)
+	assert.Equal(t, models.TickerCron, tasks[0].TickerType)
+	assert.Equal(t, "cron 0 0 9 * * MON Local", tasks[0].Schedule)
+	assert.Equal(t, time.Monday, tasks[0].NextRun.Weekday())
+	assert.Nil(t, tasks[0].LastActionTime)
+	assert.True(t, tasks[0].Paused)
+
+	assert.Equal(t, "interval", tasks[1].Name)
+	assert.Equal(t, "every 1h0m0s", tasks[1].Schedule)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), tasks[1].NextRun, time.Second)
+	assert.True(t, last.Equal(*tasks[1].LastActionTime))
+	assert.False(t, tasks[1].Running)
+	assert.Empty(t, tasks[1].LockHolder)
+
+	assert.NoError(t, s.TriggerNow("interval"))
+	<-running
+
+	tasks, err = s.Tasks(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, tasks[1].Running)
+	assert.NotEmpty(t, tasks[1].LockHolder)
+
+	close(release)
+	assert.NoError(t, s.Shutdown(context.Background()))
+}
+
+func TestHistory(t *testing.T) {
+	var (
+		b     = memorybackend.New()
+		s     = makeMemoryScheduler(b, &Options{NodeID: "node", History: &models.Retention{MaxCount: 2}})
+		calls int32
+		done  = make(chan struct{}, 10)
+	)
+
+	handle, err := s.Every().Interval(time.Hour).Start(context.Background(), "task", func(ctx context.Context) error {
+		defer func() {
+			done <- struct{}{}
+		}()
+
+		if atomic.AddInt32(&calls, 1) == 2 {
+			return errors.New("error")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	for n := 0; n < 3; n++ {
+		// the record is written right after the handler has returned
+		for b.IsLocked("task") {
+			time.Sleep(time.Millisecond)
+		}
+		assert.NoError(t, s.TriggerNow("task"))
+		<-done
+	}
+	for b.IsLocked("task") {
+		time.Sleep(time.Millisecond)
+	}
+
+	history, err := s.History(context.Background(), "task", 0)
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+
+	assert.Equal(t, models.OutcomeSucceeded, history[0].Outcome)
+	assert.Equal(t, "node", history[0].NodeID)
+	assert.Empty(t, history[0].Error)
+	assert.Equal(t, history[0].End.Sub(history[0].Start), history[0].Duration)
+
+	assert.Equal(t, models.OutcomeFailed, history[1].Outcome)
+	assert.Equal(t, "error", history[1].Error)
+	assert.True(t, history[1].Start.Before(history[0].Start))
+
+	handle.Stop()
+	s.Wait()
+}
+
+func TestExecutionState(t *testing.T) {
+	var (
+		b     = memorybackend.New()
+		s     = makeMemoryScheduler(b, &Options{NodeID: "node", History: &models.Retention{}})
+		calls int32
+		done  = make(chan struct{}, 10)
+	)
+
+	handle, err := s.Every().Interval(time.Hour).Start(context.Background(), "task", func(ctx context.Context) error {
+		defer func() {
+			done <- struct{}{}
+		}()
+
+		if atomic.AddInt32(&calls, 1) > 1 {
+			return errors.New("error")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	run := func() *models.State {
+		// the state is written right after the handler has returned
+		for b.IsLocked("task") {
+			time.Sleep(time.Millisecond)
+		}
+		assert.NoError(t, s.TriggerNow("task"))
+		<-done
+		for b.IsLocked("task") {
+			time.Sleep(time.Millisecond)
+		}
+
+		state, err := b.GetState(context.Background(), "task")
+		assert.NoError(t, err)
+		return state
+	}
+
+	succeeded := run()
+	assert.Equal(t, models.StateVersion, succeeded.Version)
+	assert.Equal(t, "node", succeeded.NodeID)
+	assert.NotEmpty(t, succeeded.RunID)
+	assert.Equal(t, 0, succeeded.ConsecutiveFailures)
+	assert.Equal(t, *succeeded.LastFinish, *succeeded.LastSuccess)
+	// the last action time stays at the claimed slot
+	assert.Equal(t, *succeeded.LastStart, *succeeded.LastAction)
+	assert.False(t, succeeded.LastStart.After(*succeeded.LastFinish))
+
+	run()
+	failed := run()
+	assert.Equal(t, 2, failed.ConsecutiveFailures)
+	assert.NotEqual(t, succeeded.RunID, failed.RunID)
+	assert.True(t, failed.LastStart.After(*succeeded.LastFinish))
+	// the failed runs do not move the last success and the last action time
+	assert.Equal(t, *succeeded.LastSuccess, *failed.LastSuccess)
+	assert.Equal(t, *succeeded.LastAction, *failed.LastAction)
+
+	// the run id links the state with the history
+	history, err := s.History(context.Background(), "task", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, failed.RunID, history[0].RunID)
+
+	handle.Stop()
+	s.Wait()
+}
@@ -0,0 +1,161 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/skvoch/reter/scheduler/backend"
+	"github.com/skvoch/reter/scheduler/models"
+)
+
+// taskEntry is the state of a task started on this node, it is the models.TaskHandle of the task
+type taskEntry struct {
+	name string
+	// cancel stops the task watcher and cancels a running handler
+	cancel context.CancelFunc
+	// done is closed when the task watcher has returned
+	done chan struct{}
+	// remove deletes the entry from the scheduler
+	remove func()
+
+	paused  int32
+	trigger chan struct{}
+	// rescheduled is signalled when a new schedule is pending
+	rescheduled chan struct{}
+
+	mx sync.Mutex
+	// lock is the task lock while the handler is running
+	lock backend.Lock
+	// pending is the schedule passed with reschedule, it is applied by the watcher
+	pending models.Schedule
+	// schedule is the schedule the watcher runs the task by, next is its next fire time
+	schedule models.Schedule
+	next     time.Time
+}
+
+func newTaskEntry(name string, cancel context.CancelFunc) *taskEntry {
+	return &taskEntry{
+		name:    name,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		remove:  func() {},
+		trigger: make(chan struct{}, 1),
+
+		rescheduled: make(chan struct{}, 1),
+	}
+}
+
+func (e *taskEntry) Name() string {
+	return e.name
+}
+
+func (e *taskEntry) Stop() {
+	e.cancel()
+}
+
+func (e *taskEntry) Done() <-chan struct{} {
+	return e.done
+}
+
+func (e *taskEntry) Wait() {
+	<-e.done
+}
+
+func (e *taskEntry) Pause() {
+	atomic.StoreInt32(&e.paused, 1)
+}
+
+func (e *taskEntry) Resume() {
+	atomic.StoreInt32(&e.paused, 0)
+}
+
+func (e *taskEntry) isPaused() bool {
+	return atomic.LoadInt32(&e.paused) == 1
+}
+
+func (e *taskEntry) Remove() {
+	e.cancel()
+	e.remove()
+}
+
+// TriggerNow requests a run, triggers made while a run is pending are merged into it
+func (e *taskEntry) TriggerNow() {
+	select {
+	case e.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// retryTrigger requests the run again after the delay, so a trigger which has not got the lock is not lost
+func (e *taskEntry) retryTrigger(delay time.Duration) {
+	time.AfterFunc(delay, e.TriggerNow)
+}
+
+// reschedule passes the schedule to the watcher, only the latest one is applied if it is called more than once
+func (e *taskEntry) reschedule(schedule models.Schedule) {
+	e.mx.Lock()
+	e.pending = schedule
+	e.mx.Unlock()
+
+	select {
+	case e.rescheduled <- struct{}{}:
+	default:
+	}
+}
+
+func (e *taskEntry) takeSchedule() models.Schedule {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+
+	return e.pending
+}
+
+func (e *taskEntry) setSchedule(schedule models.Schedule) {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+
+	e.schedule = schedule
+	e.next = time.Time{}
+}
+
+func (e *taskEntry) setNext(next time.Time) {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+
+	e.next = next
+}
+
+// plan returns the current schedule and its next fire time
+func (e *taskEntry) plan() (models.Schedule, time.Time) {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+
+	return e.schedule, e.next
+}
+
+// isRunning reports whether the handler is running, the lock is held only while it runs
+func (e *taskEntry) isRunning() bool {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+
+	return e.lock != nil
+}
+
+func (e *taskEntry) setLock(l backend.Lock) {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+
+	e.lock = l
+}
+
+// takeLock returns the held lock and forgets it, so it is released only once
+func (e *taskEntry) takeLock() backend.Lock {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+
+	out := e.lock
+	e.lock = nil
+	return out
+}